@@ -3,17 +3,27 @@ package gitstr
 import (
 	"context"
 
+	"github.com/fatih/color"
 	"github.com/nbd-wtf/go-nostr"
 	"github.com/urfave/cli/v3"
 )
 
 var pool *nostr.SimplePool
 
+// runningCommand is the command whose action is being run, flags like --sec are only visible from it and
+// not from the root, so this is what the auth handler and the outbox use to sign
+var runningCommand *cli.Command
+
 const (
 	RepoAnnouncementKind = 30617
+	RepoStateKind        = 30618
 	PatchKind            = 1617
 	IssueKind            = 1621
 	ReplyKind            = 1622
+	StatusOpenKind       = 1630
+	StatusAppliedKind    = 1631
+	StatusClosedKind     = 1632
+	StatusDraftKind      = 1633
 )
 
 var App = &cli.Command{
@@ -21,13 +31,84 @@ var App = &cli.Command{
 	Description:            "NIP-34 git nostr helper",
 	Suggest:                true,
 	UseShortOptionHandling: true,
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:       "json",
+			Usage:      "print results as JSON on stdout, implies --non-interactive",
+			Persistent: true,
+			Action: func(ctx context.Context, c *cli.Command, v bool) error {
+				// this runs on whatever command the flag was given to, so it works before or after it
+				jsonOutput = v
+				color.NoColor = color.NoColor || v
+				return nil
+			},
+		},
+		&cli.BoolFlag{
+			Name:       "non-interactive",
+			Usage:      "never prompt, take answers from flags and git config or fail saying which flag to give (automatic when stdin or stdout aren't a terminal)",
+			Persistent: true,
+			Action: func(ctx context.Context, c *cli.Command, v bool) error {
+				nonInteractive = v
+				return nil
+			},
+		},
+		&cli.BoolFlag{
+			Name:       "yes",
+			Aliases:    []string{"y"},
+			Usage:      "answer yes to all confirmations, like the one before publishing",
+			Persistent: true,
+			Action: func(ctx context.Context, c *cli.Command, v bool) error {
+				assumeYes = v
+				return nil
+			},
+		},
+	},
 	Before: func(ctx context.Context, c *cli.Command) error {
-		pool = nostr.NewSimplePool(ctx)
+		pool = nostr.NewSimplePool(ctx, nostr.WithAuthHandler(authHandler(ctx)))
 		return nil
 	},
 	Commands: []*cli.Command{
 		initRepo,
+		repoCmd,
+		reposCmd,
+		list,
 		download,
+		syncCmd,
+		apply,
+		rangeDiff,
 		send,
+		issue,
+		reply,
+		review,
+		show,
+		status,
+		pushState,
+		state,
+		outboxCmd,
 	},
 }
+
+func init() {
+	trackRunningCommand(App.Commands)
+}
+
+// trackRunningCommand wraps the actions of the given commands and their subcommands so they set
+// runningCommand and, except for the outbox command, retry pending events from the outbox before doing
+// anything else
+func trackRunningCommand(commands []*cli.Command) {
+	for _, cmd := range commands {
+		trackRunningCommand(cmd.Commands)
+		if cmd.Action == nil {
+			continue
+		}
+		action := cmd.Action
+		cmd.Action = func(ctx context.Context, c *cli.Command) error {
+			runningCommand = c
+			if c != outboxCmd {
+				// the outbox command retries or drops entries itself
+				flushOutbox(ctx, false)
+			}
+			return action(ctx, c)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package gitstr
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/urfave/cli/v3"
+)
+
+var (
+	patchIndexRegex   = regexp.MustCompile(`^\[PATCH[^\]]*?(\d+)/(\d+)\]`)
+	patchVersionRegex = regexp.MustCompile(`^\[PATCH[^\]]*?\bv(\d+)\b`)
+	patchAuthorRegex  = regexp.MustCompile(`(?m)^From: (.*?) *<`)
+	nonSlugRegex      = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+var apply = &cli.Command{
+	Name:        "apply",
+	Usage:       "download a patch series and apply it on a new branch",
+	UsageText:   "git str apply <nevent>",
+	Description: "",
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:    "relay",
+			Aliases: []string{"r"},
+			Usage:   "extra relays to search for the patches in",
+		},
+		&cli.StringFlag{
+			Name:    "branch",
+			Aliases: []string{"b"},
+			Usage:   "name of the branch to create, defaults to <author>/<subject>",
+		},
+		&cli.StringFlag{
+			Name:  "base",
+			Usage: "commit or branch on top of which the patches will be applied, defaults to the patch parent commit if we have it or HEAD",
+		},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		series, err := fetchSeriesFromArg(ctx, c.Args().First(), c.StringSlice("relay"))
+		if err != nil {
+			return err
+		}
+		logf("%s %d patches\n", color.YellowString("found series with"), len(series))
+
+		// write everything into a single mailbox so `git am` can resume after conflicts
+		gitDir, err := git("rev-parse", "--absolute-git-dir")
+		if err != nil {
+			return fmt.Errorf("failed to find git directory: %w", err)
+		}
+		base := filepath.Join(gitDir, "str")
+		if err := os.MkdirAll(base, 0755); err != nil {
+			return fmt.Errorf("failed to create .git/str directory")
+		}
+		mbox := filepath.Join(base, "apply-"+series[0].ID[0:8]+".mbox")
+		root := series[0]
+		if isCoverLetter(root) {
+			logf("%s\n\n%s\n\n", color.YellowString("cover letter:"), series[0].Content)
+			series = series[1:]
+		}
+		if len(series) == 0 {
+			return fmt.Errorf("this series has no patches besides the cover letter")
+		}
+		if err := os.WriteFile(mbox, seriesMailbox(series), 0644); err != nil {
+			return fmt.Errorf("failed to write '%s': %w", mbox, err)
+		}
+
+		branch := c.String("branch")
+		if branch == "" {
+			branch = seriesBranchName(root)
+		}
+		startPoint := c.String("base")
+		if startPoint == "" {
+			startPoint = getSeriesBase(series)
+		}
+		if _, err := git("checkout", "-b", branch, startPoint); err != nil {
+			return fmt.Errorf("failed to create branch '%s': %w", branch, err)
+		}
+		logf("%s %s\n", color.YellowString("created branch"), branch)
+		result := applyResult{Branch: branch, Base: startPoint, Applied: []string{}}
+
+		if _, err := git("am", "--3way", mbox); err != nil {
+			// find out where it stopped
+			next := 1
+			if dir, err := git("rev-parse", "--git-path", "rebase-apply"); err == nil {
+				if b, err := os.ReadFile(filepath.Join(dir, "next")); err == nil {
+					next, _ = strconv.Atoi(strings.TrimSpace(string(b)))
+				}
+			}
+			conflicts, _ := git("diff", "--name-only", "--diff-filter=U")
+
+			for i, patch := range series {
+				subject := getPatchSubject(patch)
+				switch {
+				case i+1 < next:
+					logf("  %s %s\n", color.GreenString("applied"), subject)
+					result.Applied = append(result.Applied, subject)
+				case i+1 == next:
+					logf("  %s %s\n", color.RedString("conflict"), subject)
+					for _, file := range split(conflicts) {
+						logf("    %s\n", file)
+					}
+					result.Conflict = subject
+					result.ConflictFiles = split(conflicts)
+				default:
+					logf("  %s %s\n", color.New(color.Faint).Sprint("pending"), subject)
+					result.Pending = append(result.Pending, subject)
+				}
+			}
+			if jsonOutput {
+				printJSON(result)
+			}
+			return fmt.Errorf("failed to apply patch %d, resolve the conflicts and call `git am --continue` or give up with `git am --abort`", next)
+		}
+
+		for _, patch := range series {
+			logf("  %s %s\n", color.GreenString("applied"), getPatchSubject(patch))
+			result.Applied = append(result.Applied, getPatchSubject(patch))
+		}
+		os.Remove(mbox)
+		if jsonOutput {
+			printJSON(result)
+		}
+		return nil
+	},
+}
+
+// applyResult is what `apply` prints with --json, when there is a conflict the patch that caused it and the
+// files involved are included
+type applyResult struct {
+	Branch        string   `json:"branch"`
+	Base          string   `json:"base"`
+	Applied       []string `json:"applied"`
+	Conflict      string   `json:"conflict,omitempty"`
+	ConflictFiles []string `json:"conflict_files,omitempty"`
+	Pending       []string `json:"pending,omitempty"`
+}
+
+// fetchSeriesFromArg takes an nevent pointing to any patch in a series and returns the entire series
+func fetchSeriesFromArg(ctx context.Context, arg string, extraRelays []string) ([]*nostr.Event, error) {
+	filter, hintRelays, err := getPatchFilter(arg, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(filter.IDs) == 0 {
+		return nil, fmt.Errorf("expected an nevent pointing to a patch, got '%s'", arg)
+	}
+	relays := concatSlices(getPatchRelays(), extraRelays, hintRelays)
+
+	ie := querySingle(ctx, relays, filter)
+	if ie == nil {
+		return nil, fmt.Errorf("couldn't find patch %s", filter.IDs[0])
+	}
+	if rootID := getThreadRootID(ie.Event); rootID != ie.ID {
+		ie = querySingle(ctx, relays, nostr.Filter{IDs: []string{rootID}})
+		if ie == nil {
+			return nil, fmt.Errorf("couldn't find the first patch of the series, %s", rootID)
+		}
+	}
+
+	if rep, ok := getEventRepositoryPointer(ie.Event); ok {
+		if repo := fetchRepository(ctx, rep, relays); repo != nil {
+			relays = append(relays, getRepositoryRelays(repo.Event)...)
+		}
+	}
+
+	return fetchSeries(ctx, relays, ie.Event), nil
+}
+
+// fetchSeries returns the given root patch followed by the other patches in its thread, in order
+func fetchSeries(ctx context.Context, relays []string, root *nostr.Event) []*nostr.Event {
+	series := []*nostr.Event{root}
+	revisions := 0
+	for _, evt := range fetchThread(ctx, relays, root.ID) {
+		if evt.Kind != PatchKind {
+			continue
+		}
+		// revisions reference the series they revise, but they're series of their own
+		if getRevisedRootID(evt) == root.ID {
+			revisions++
+			continue
+		}
+		if evt.PubKey == root.PubKey && hasRootMarker(evt, root.ID) {
+			series = append(series, evt)
+		}
+	}
+	if revisions > 0 {
+		logf(color.YellowString("this series has %d newer revisions, see them with `git str list`\n"), revisions)
+	}
+
+	slices.SortStableFunc(series[1:], func(a, b *nostr.Event) int {
+		ai, bi := getPatchIndex(a), getPatchIndex(b)
+		if ai != bi {
+			return ai - bi
+		}
+		return int(a.CreatedAt - b.CreatedAt)
+	})
+	return series
+}
+
+// fetchRevisions returns the first patch of each revision of the series started by root
+func fetchRevisions(ctx context.Context, relays []string, root *nostr.Event) []*nostr.Event {
+	return filterSlice(fetchThread(ctx, relays, root.ID), func(evt *nostr.Event) bool {
+		return getRevisedRootID(evt) == root.ID
+	})
+}
+
+func hasRootMarker(evt *nostr.Event, rootID string) bool {
+	for _, tag := range evt.Tags.GetAll([]string{"e", rootID}) {
+		if len(tag) >= 4 && tag[1] == rootID && tag[3] == "root" {
+			return true
+		}
+	}
+	return false
+}
+
+// getSeriesBase returns the parent commit of the first patch if we have it, otherwise HEAD
+func getSeriesBase(series []*nostr.Event) string {
+	if tag := series[0].Tags.GetFirst([]string{"parent-commit", ""}); tag != nil {
+		if hasCommit((*tag)[1]) {
+			return (*tag)[1]
+		}
+		logf(color.YellowString("base commit %s not found locally, applying on HEAD\n"), (*tag)[1])
+	}
+	return "HEAD"
+}
+
+// seriesMailbox puts all patches together in a format `git am` understands
+func seriesMailbox(series []*nostr.Event) []byte {
+	contents := make([]string, len(series))
+	for i, patch := range series {
+		contents[i] = strings.TrimSpace(patch.Content) + "\n"
+	}
+	return []byte(strings.Join(contents, "\n"))
+}
+
+func getPatchSubject(patch *nostr.Event) string {
+	if match := subjectRegex.FindStringSubmatch(patch.Content); len(match) > 0 {
+		return match[1]
+	}
+	return ""
+}
+
+// getPatchIndex reads the "n" in "[PATCH n/m]", returning 0 when there is none
+func getPatchIndex(patch *nostr.Event) int {
+	if match := patchIndexRegex.FindStringSubmatch(getPatchSubject(patch)); len(match) > 0 {
+		idx, _ := strconv.Atoi(match[1])
+		return idx
+	}
+	return 0
+}
+
+// getPatchVersion reads the "n" in "[PATCH vn]", a patch without it is the version 1
+func getPatchVersion(patch *nostr.Event) int {
+	if match := patchVersionRegex.FindStringSubmatch(getPatchSubject(patch)); len(match) > 0 {
+		v, _ := strconv.Atoi(match[1])
+		return v
+	}
+	return 1
+}
+
+func isCoverLetter(patch *nostr.Event) bool {
+	if patch.Tags.GetFirst([]string{"t", "cover-letter"}) != nil {
+		return true
+	}
+	match := patchIndexRegex.FindStringSubmatch(getPatchSubject(patch))
+	return len(match) > 0 && match[1] == "0"
+}
+
+func seriesBranchName(root *nostr.Event) string {
+	author := root.PubKey[0:8]
+	if match := patchAuthorRegex.FindStringSubmatch(root.Content); len(match) > 0 {
+		author = match[1]
+	}
+
+	subject := getPatchSubject(root)
+	if strings.HasPrefix(subject, "[") {
+		if _, rest, ok := strings.Cut(subject, "]"); ok {
+			subject = rest
+		}
+	}
+
+	slugify := func(s string, max int) string {
+		s = strings.Trim(nonSlugRegex.ReplaceAllString(strings.ToLower(s), "-"), "-")
+		if len(s) > max {
+			s = strings.TrimRight(s[0:max], "-")
+		}
+		return s
+	}
+
+	// names and subjects without any latin letters or digits would leave nothing
+	return valueOr(slugify(author, 20), root.PubKey[0:8]) + "/" + valueOr(slugify(subject, 40), root.ID[0:8])
+}
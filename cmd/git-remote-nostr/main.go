@@ -0,0 +1,21 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/fiatjaf/gitstr"
+)
+
+func main() {
+	if len(os.Args) < 3 {
+		fmt.Fprintln(os.Stderr, "usage: git-remote-nostr <remote> nostr://<naddr>")
+		os.Exit(1)
+	}
+
+	if err := gitstr.RunRemoteHelper(context.Background(), os.Args[1], os.Args[2]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -10,7 +10,7 @@ import (
 
 func main() {
 	if err := gitstr.App.Run(context.Background(), os.Args); err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
@@ -29,16 +29,51 @@ var download = &cli.Command{
 			Aliases: []string{"l"},
 			Value:   15,
 		},
+		&cli.BoolFlag{
+			Name:  "all",
+			Usage: "keep fetching older patches until relays have nothing more to give, --limit is used as the page size",
+		},
+		&cli.StringFlag{
+			Name:  "since",
+			Usage: "only download patches created after this date (2006-01-02) or within this duration (10d, 48h), implies --all",
+		},
+		&cli.StringFlag{
+			Name:  "until",
+			Usage: "only download patches created before this date (2006-01-02) or before this duration (10d, 48h) ago",
+		},
+		&cli.BoolFlag{
+			Name:  "closed",
+			Usage: "also download patches that were already marked as applied or closed",
+		},
 	},
 	Action: func(ctx context.Context, c *cli.Command) error {
-		id := getRepositoryID()
-		pk := getRepositoryPublicKey()
-		if pk == "" || id == "" {
+		if getRepositoryPublicKey() == "" || getRepositoryID() == "" {
 			logf("no repository id and pubkey found on `git config`, this command will only work with specific naddr or nevent patches.\n")
 		}
 
 		limit := c.Int("limit")
-		relays := append(getPatchRelays(), c.StringSlice("relay")...)
+		paginate := c.Bool("all") || c.String("since") != ""
+		if paginate && !c.IsSet("limit") {
+			limit = 100
+		}
+
+		var since, until *nostr.Timestamp
+		if str := c.String("since"); str != "" {
+			ts, err := parseTime(str)
+			if err != nil {
+				return err
+			}
+			since = &ts
+		}
+		if str := c.String("until"); str != "" {
+			ts, err := parseTime(str)
+			if err != nil {
+				return err
+			}
+			until = &ts
+		}
+
+		relays := concatSlices(getPatchRelays(), c.StringSlice("relay"))
 
 		// patches we will try to browse -- if given an author we try to get all their patches targeting this repo,
 		// if given an event pointer we will try to fetch that patch specifically and so on, if given nothing we will
@@ -48,55 +83,30 @@ var download = &cli.Command{
 			items = []string{""}
 		}
 
+		results := make([]downloadedPatch, 0, limit)
 		for _, arg := range items {
-			filter := nostr.Filter{
-				Limit: int(limit),
-				Kinds: []int{PatchKind},
-				Tags:  nostr.TagMap{},
+			filter, extraRelays, err := getPatchFilter(arg, int(limit))
+			if err != nil {
+				logf("%s\n", err)
+				continue
 			}
-			relays := slices.Clone(relays)
+			relays := append(slices.Clone(relays), extraRelays...)
 
-			if arg != "" {
-				prefix, data, err := nip19.Decode(arg)
-				if err != nil {
-					logf("invalid argument '%s': %s\n", arg, err)
-					continue
-				}
-
-				switch prefix {
-				case "npub":
-					filter.Authors = append(filter.Authors, data.(string))
-					filter.Tags["a"] = []string{fmt.Sprintf("%d:%s:%s", RepoAnnouncementKind, pk, id)}
-				case "nprofile":
-					pp := data.(nostr.ProfilePointer)
-					filter.Authors = append(filter.Authors, pp.PublicKey)
-					filter.Tags["a"] = []string{fmt.Sprintf("%d:%s:%s", RepoAnnouncementKind, pk, id)}
-					relays = append(relays, pp.Relays...)
-				case "nevent":
-					ep := data.(nostr.EventPointer)
-					if ep.Kind != 0 && ep.Kind != PatchKind {
-						logf("invalid argument %s: expected an encoded kind %d or nothing\n", arg, PatchKind)
-						continue
-					}
-					filter = nostr.Filter{IDs: []string{ep.ID}}
-					relays = append(relays, ep.Relays...)
-				case "naddr":
-					ep := data.(nostr.EntityPointer)
-					if ep.Kind != RepoAnnouncementKind {
-						logf("invalid argument %s: expected an encoded kind %d\n", arg, RepoAnnouncementKind)
-						continue
-					}
+			// read from where the authors publish
+			if len(filter.Authors) > 0 {
+				relays = append(relays, getOutboxRelays(ctx, relays, filter.Authors)...)
+			}
 
-					filter = nostr.Filter{
-						Limit: int(limit),
-						Kinds: []int{PatchKind},
-						Tags: nostr.TagMap{
-							"a": []string{fmt.Sprintf("%d:%s:%s", RepoAnnouncementKind, ep.PublicKey, ep.Identifier)},
-						},
+			// patches may be addressed to any of the maintainers' announcements
+			if addresses := filter.Tags["a"]; len(addresses) == 1 {
+				spl := strings.SplitN(addresses[0], ":", 3)
+				if len(spl) == 3 && nostr.IsValidPublicKey(spl[1]) {
+					ep := nostr.EntityPointer{PublicKey: spl[1], Kind: RepoAnnouncementKind, Identifier: spl[2]}
+					repos := fetchMaintainerRepositories(ctx, ep, relays)
+					for _, repo := range repos {
+						relays = append(relays, getRepositoryRelays(repo)...)
 					}
-					relays = append(relays, ep.Relays...)
-				default:
-					continue
+					filter.Tags["a"] = getRepositoryAddresses(ep, repos)
 				}
 			}
 
@@ -108,28 +118,205 @@ var download = &cli.Command{
 				return fmt.Errorf("failed to create .git/str directory")
 			}
 
-			for ie := range pool.SubManyEose(ctx, relays, nostr.Filters{filter}) {
+			var events []*nostr.Event
+			if len(filter.IDs) > 0 {
+				events = queryEvents(ctx, relays, filter)
+			} else {
+				filter.Since = since
+				filter.Until = until
+				if paginate {
+					events = paginateEvents(ctx, relays, filter)
+				} else {
+					events = queryEvents(ctx, relays, filter)
+				}
+			}
+
+			// patches that were already resolved are skipped, unless specifically requested
+			skipResolved := !c.Bool("closed") && len(filter.IDs) == 0
+			statuses := fetchStatuses(ctx, relays, events)
+
+			for _, ie := range events {
 				nevent, _ := nip19.EncodeEvent(ie.ID, nil, "")
+				result := downloadedPatch{ID: ie.ID, Nevent: nevent, Author: ie.PubKey, Status: "open"}
+
+				if status, ok := statuses[getThreadRootID(ie)]; ok {
+					result.Status = statusName(status)
+					if skipResolved && (status.Kind == StatusAppliedKind || status.Kind == StatusClosedKind) {
+						logf("- skipping patch %s, marked as %s\n", ie.ID, sprintStatus(status))
+						result.Skipped = true
+						results = append(results, result)
+						continue
+					}
+				}
+
 				npub, _ := nip19.EncodePublicKey(ie.PubKey)
-				subjectMatch := subjectRegex.FindStringSubmatch(ie.Event.Content)
+				subjectMatch := subjectRegex.FindStringSubmatch(ie.Content)
 				if len(subjectMatch) == 0 {
 					continue
 				}
 				subject := subjectMatch[1]
+				result.Subject = subject
 				subject = strings.ReplaceAll(strings.ReplaceAll(subject, "/", "_"), "'", "")
 				fileName := base + "/" + fmt.Sprintf("%s [%s] %s",
 					ie.CreatedAt.Time().Format(time.DateOnly), nevent[65:], subject)
+				result.File = fileName
+				results = append(results, result)
 				if _, err := os.Stat(fileName); os.IsNotExist(err) {
 					logf("- downloaded patch %s from %s, saved as '%s'\n",
-						ie.Event.ID, npub, color.New(color.Underline).Sprint(fileName))
-					if err := os.WriteFile(fileName, []byte(ie.Event.Content), 0644); err != nil {
+						ie.ID, npub, color.New(color.Underline).Sprint(fileName))
+					if revised := getRevisedRootID(ie); revised != "" {
+						logf("  (a new revision of %s)\n", revised)
+					}
+					if tag := ie.Tags.GetFirst([]string{"parent-commit", ""}); tag != nil {
+						if hasCommit((*tag)[1]) {
+							logf("  applies on top of %s\n", (*tag)[1])
+						} else {
+							logf(color.YellowString("  base commit %s not found locally, you may need to fetch it first\n"), (*tag)[1])
+						}
+					}
+					if err := os.WriteFile(fileName, []byte(ie.Content), 0644); err != nil {
 						return fmt.Errorf("failed to write '%s': %w", fileName, err)
 					}
-					os.Chtimes(fileName, time.Time{}, ie.Event.CreatedAt.Time())
+					os.Chtimes(fileName, time.Time{}, ie.CreatedAt.Time())
 				}
 			}
 		}
 
+		if jsonOutput {
+			printJSON(results)
+		}
 		return nil
 	},
 }
+
+// downloadedPatch is how each patch is reported with --json, skipped ones have no file
+type downloadedPatch struct {
+	ID      string `json:"id"`
+	Nevent  string `json:"nevent"`
+	Author  string `json:"author"`
+	Subject string `json:"subject,omitempty"`
+	Status  string `json:"status"`
+	File    string `json:"file,omitempty"`
+	Skipped bool   `json:"skipped,omitempty"`
+}
+
+// getPatchFilter turns an argument to download -- an npub, nprofile, nevent, naddr or nothing -- into a
+// filter for patches, also returning the relays hinted by the argument
+func getPatchFilter(arg string, limit int) (nostr.Filter, []string, error) {
+	id := getRepositoryID()
+	pk := getRepositoryPublicKey()
+
+	filter := nostr.Filter{
+		Limit: limit,
+		Kinds: []int{PatchKind},
+		Tags:  nostr.TagMap{},
+	}
+	if arg == "" {
+		if id != "" && pk != "" {
+			filter.Tags["a"] = []string{fmt.Sprintf("%d:%s:%s", RepoAnnouncementKind, pk, id)}
+		}
+		return filter, nil, nil
+	}
+
+	prefix, data, err := nip19.Decode(arg)
+	if err != nil {
+		return filter, nil, fmt.Errorf("invalid argument '%s': %w", arg, err)
+	}
+
+	switch prefix {
+	case "npub":
+		filter.Authors = append(filter.Authors, data.(string))
+		filter.Tags["a"] = []string{fmt.Sprintf("%d:%s:%s", RepoAnnouncementKind, pk, id)}
+		return filter, nil, nil
+	case "nprofile":
+		pp := data.(nostr.ProfilePointer)
+		filter.Authors = append(filter.Authors, pp.PublicKey)
+		filter.Tags["a"] = []string{fmt.Sprintf("%d:%s:%s", RepoAnnouncementKind, pk, id)}
+		return filter, pp.Relays, nil
+	case "nevent":
+		ep := data.(nostr.EventPointer)
+		if ep.Kind != 0 && ep.Kind != PatchKind {
+			return filter, nil, fmt.Errorf("invalid argument %s: expected an encoded kind %d or nothing", arg, PatchKind)
+		}
+		filter := nostr.Filter{IDs: []string{ep.ID}}
+		if ep.Author != "" {
+			filter.Authors = []string{ep.Author}
+		}
+		return filter, ep.Relays, nil
+	case "naddr":
+		ep := data.(nostr.EntityPointer)
+		if ep.Kind != RepoAnnouncementKind {
+			return filter, nil, fmt.Errorf("invalid argument %s: expected an encoded kind %d", arg, RepoAnnouncementKind)
+		}
+		filter.Tags["a"] = []string{fmt.Sprintf("%d:%s:%s", RepoAnnouncementKind, ep.PublicKey, ep.Identifier)}
+		return filter, ep.Relays, nil
+	default:
+		return filter, nil, fmt.Errorf("invalid argument '%s': unsupported %s", arg, prefix)
+	}
+}
+
+// paginateEvents keeps moving the "until" of the filter backwards, one page of filter.Limit at a time,
+// until relays stop returning new events or we reach filter.Since
+func paginateEvents(ctx context.Context, relays []string, filter nostr.Filter) []*nostr.Event {
+	seen := make(map[string]bool)
+	events := make([]*nostr.Event, 0, filter.Limit)
+
+	until := nostr.Now()
+	if filter.Until != nil {
+		until = *filter.Until
+	}
+
+	// collect adds the events we haven't seen yet, returning how many relays gave us, how many were new and
+	// the timestamp of the oldest
+	collect := func(filter nostr.Filter) (got int, added int, oldest nostr.Timestamp) {
+		oldest = *filter.Until
+		for _, evt := range queryEvents(ctx, relays, filter) {
+			got++
+			if evt.CreatedAt < oldest {
+				oldest = evt.CreatedAt
+			}
+			if seen[evt.ID] {
+				continue
+			}
+			seen[evt.ID] = true
+			events = append(events, evt)
+			added++
+		}
+		return got, added, oldest
+	}
+
+	for {
+		filter.Until = &until
+		got, added, oldest := collect(filter)
+		logf("- got %d patches until %s\n", added, humanDate(until))
+
+		if got == 0 || (filter.Since != nil && oldest <= *filter.Since) {
+			break
+		}
+		if oldest == until {
+			// the whole page has the same timestamp (patches of a series usually do), so asking again
+			// would give us the same events, we have to skip past it -- but first get everything from that
+			// second, as there may be more than fit on a page
+			if filter.Limit > 0 && got >= filter.Limit {
+				second := filter
+				since := until
+				second.Since = &since
+				second.Limit = filter.Limit * 10
+				got, added, _ := collect(second)
+				logf("- got %d more patches at %s\n", added, humanDate(until))
+				if got >= second.Limit {
+					logf(color.YellowString("more than %d patches at %s, some of them may have been skipped\n"),
+						second.Limit, humanDate(until))
+				}
+			}
+			until--
+			continue
+		}
+		if added == 0 {
+			break
+		}
+		until = oldest
+	}
+
+	return events
+}
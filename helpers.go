@@ -3,10 +3,12 @@ package gitstr
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -22,6 +24,12 @@ import (
 
 var subjectRegex = regexp.MustCompile(`(?m)^Subject: (.*)$`)
 
+// profileRelays are queried in addition to the repository relays when looking for user metadata
+var profileRelays = []string{"wss://purplepag.es", "wss://relay.nostr.band"}
+
+// announcementRelays are queried in addition to any others given when searching for repositories
+var announcementRelays = []string{"wss://relay.nostr.band", "wss://relay.damus.io", "wss://nos.lol"}
+
 func logf(str string, args ...any) {
 	fmt.Fprintf(os.Stderr, fmt.Sprintf(str, args...))
 }
@@ -31,6 +39,22 @@ func isPiped() bool {
 	return stat.Mode()&os.ModeCharDevice == 0
 }
 
+// nonInteractive is set by the global --non-interactive flag, assumeYes by --yes
+var (
+	nonInteractive bool
+	assumeYes      bool
+)
+
+// interactive tells if we can prompt the user, which is never the case with --non-interactive or --json, or
+// when stdin or stdout aren't a terminal -- prompts then take flags or config values or fail naming them
+func interactive() bool {
+	if nonInteractive || jsonOutput || isPiped() {
+		return false
+	}
+	stat, _ := os.Stdout.Stat()
+	return stat.Mode()&os.ModeCharDevice != 0
+}
+
 func gatherSecretKeyOrBunker(ctx context.Context, c *cli.Command) (
 	bunker *nip46.BunkerClient,
 	key string,
@@ -43,7 +67,11 @@ func gatherSecretKeyOrBunker(ctx context.Context, c *cli.Command) (
 
 	defer func() {
 		if err == nil {
-			if storeWithoutAsking || (askToStore && confirm("store the secret key on git config? ")) {
+			store := storeWithoutAsking
+			if askToStore {
+				store = confirmOptional("store the secret key on git config? ")
+			}
+			if store {
 				git("config", "--local", "str.auth", secOrBunker)
 			}
 		}
@@ -67,6 +95,9 @@ func gatherSecretKeyOrBunker(ctx context.Context, c *cli.Command) (
 		git("config", "--local", "str.auth", secOrBunker) // TODO: remove this after a while
 	}
 
+	if secOrBunker == "" && !interactive() {
+		return nil, "", false, fmt.Errorf("no secret key, give one with --sec or store it with `git config str.auth <key>`")
+	}
 	if secOrBunker == "" {
 		secOrBunker, _ = ask("input secret key (hex, nsec, ncryptsec or bunker): ", "", func(answer string) bool {
 			switch {
@@ -115,7 +146,70 @@ func gatherSecretKeyOrBunker(ctx context.Context, c *cli.Command) (
 		return nil, "", false, fmt.Errorf("invalid secret key")
 	}
 
-	return nil, "", false, fmt.Errorf("couldn't gather secret key")
+	return nil, secOrBunker, false, nil
+}
+
+// signer is kept after the first time we gather it, so relay authentication and the command share it
+var signer func(*nostr.Event) error
+
+func gatherSigner(ctx context.Context, c *cli.Command) (func(*nostr.Event) error, error) {
+	if signer != nil && !c.IsSet("sec") {
+		return signer, nil
+	}
+
+	bunker, sec, isEncrypted, err := gatherSecretKeyOrBunker(ctx, c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get authentication data: %w", err)
+	}
+	if isEncrypted {
+		sec, err = promptDecrypt(sec)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if bunker != nil {
+		signer = func(evt *nostr.Event) error {
+			logf(color.YellowString("signing event with bunker..."))
+			if err := bunker.SignEvent(ctx, evt); err != nil {
+				return fmt.Errorf("error signing event with bunker: %w", err)
+			}
+			return nil
+		}
+		return signer, nil
+	}
+
+	signer = func(evt *nostr.Event) error {
+		if err := evt.Sign(sec); err != nil {
+			return fmt.Errorf("error signing event with key: %w", err)
+		}
+		return nil
+	}
+	return signer, nil
+}
+
+// publish sends the event to all the given relays, returning those that accepted it -- the others are
+// kept on the outbox to be retried later
+func publish(ctx context.Context, evt nostr.Event, relays []string) []string {
+	successRelays := make([]string, 0, len(relays))
+	failed := make(map[string]error)
+	for _, r := range relays {
+		logf("publishing to %s...", r)
+		if relay, err := pool.EnsureRelay(r); err == nil {
+			if err := publishToRelay(ctx, relay, evt); err != nil {
+				logf(" failed: %s\n", err)
+				failed[relay.URL] = err
+			} else {
+				logf("done\n")
+				successRelays = append(successRelays, relay.URL)
+			}
+		} else {
+			logf(" failed: %s\n", err)
+			failed[nostr.NormalizeURL(r)] = err
+		}
+	}
+	enqueue(evt, successRelays, failed)
+	return successRelays
 }
 
 func getPatchRelays() []string {
@@ -146,6 +240,128 @@ func getRepositoryPublicKey() string {
 	return ""
 }
 
+// getRepositoryPointer returns the repository we are dealing with: the one given with --to, or the
+// upstream we send patches to, or our own announcement if we are the maintainers
+func getRepositoryPointer(c *cli.Command) (nostr.EntityPointer, error) {
+	target := c.String("to")
+	if target == "" {
+		target, _ = git("config", "--local", "str.upstream")
+	}
+
+	if target != "" {
+		_, data, _ := nip19.Decode(target)
+		ep, ok := data.(nostr.EntityPointer)
+		if !ok {
+			return ep, fmt.Errorf("invalid target '%s'", target)
+		}
+		if ep.Kind != RepoAnnouncementKind {
+			return ep, fmt.Errorf("invalid kind %d, expected %d", ep.Kind, RepoAnnouncementKind)
+		}
+		return ep, nil
+	}
+
+	id := getRepositoryID()
+	pk := getRepositoryPublicKey()
+	if pk == "" || id == "" {
+		return nostr.EntityPointer{}, fmt.Errorf("no target repository found, specify one with --to or call `git str init`")
+	}
+
+	return nostr.EntityPointer{
+		PublicKey:  pk,
+		Kind:       RepoAnnouncementKind,
+		Identifier: id,
+		Relays:     getPatchRelays(),
+	}, nil
+}
+
+func fetchRepository(ctx context.Context, ep nostr.EntityPointer, extraRelays []string) *foundEvent {
+	return querySingle(ctx, concatSlices(ep.Relays, extraRelays), nostr.Filter{
+		Tags:    nostr.TagMap{"d": {ep.Identifier}},
+		Authors: []string{ep.PublicKey},
+		Kinds:   []int{ep.Kind},
+	})
+}
+
+func getRepositoryRelays(repo *nostr.Event) []string {
+	relays := make([]string, 0, 5)
+	for _, tag := range repo.Tags.GetAll([]string{"patches", ""}) {
+		relays = append(relays, tag[1:]...)
+	}
+	for _, tag := range repo.Tags.GetAll([]string{"relays", ""}) {
+		relays = append(relays, tag[1:]...)
+	}
+	return relays
+}
+
+// getEventRepositoryPointer reads the "a" tag of a patch, issue or reply
+func getEventRepositoryPointer(evt *nostr.Event) (nostr.EntityPointer, bool) {
+	aTag := evt.Tags.GetFirst([]string{"a", fmt.Sprintf("%d:", RepoAnnouncementKind)})
+	if aTag == nil {
+		return nostr.EntityPointer{}, false
+	}
+	spl := strings.SplitN((*aTag)[1], ":", 3)
+	if len(spl) != 3 || !nostr.IsValidPublicKey(spl[1]) {
+		return nostr.EntityPointer{}, false
+	}
+	ep := nostr.EntityPointer{
+		PublicKey:  spl[1],
+		Kind:       RepoAnnouncementKind,
+		Identifier: spl[2],
+	}
+	if len(*aTag) >= 3 && (*aTag)[2] != "" {
+		ep.Relays = []string{(*aTag)[2]}
+	}
+	return ep, true
+}
+
+func parseEventPointer(arg string) (nostr.EventPointer, error) {
+	arg = strings.TrimSpace(arg)
+	if nostr.IsValid32ByteHex(arg) {
+		return nostr.EventPointer{ID: arg}, nil
+	}
+
+	prefix, data, err := nip19.Decode(arg)
+	if err != nil {
+		return nostr.EventPointer{}, fmt.Errorf("invalid event reference '%s': %w", arg, err)
+	}
+	switch prefix {
+	case "nevent":
+		return data.(nostr.EventPointer), nil
+	case "note":
+		return nostr.EventPointer{ID: data.(string)}, nil
+	default:
+		return nostr.EventPointer{}, fmt.Errorf("invalid event reference '%s': expected nevent, note or hex", arg)
+	}
+}
+
+// parsePublicKey takes an npub, nprofile, hex key or NIP-05 address and returns the hex public key
+func parsePublicKey(ctx context.Context, arg string) (string, error) {
+	arg = strings.TrimSpace(arg)
+	if nostr.IsValidPublicKey(arg) {
+		return arg, nil
+	}
+	if nip05.IsValidIdentifier(arg) {
+		pp, err := nip05.QueryIdentifier(ctx, arg)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve '%s': %w", arg, err)
+		}
+		return pp.PublicKey, nil
+	}
+
+	prefix, data, err := nip19.Decode(arg)
+	if err != nil {
+		return "", fmt.Errorf("invalid public key '%s': %w", arg, err)
+	}
+	switch prefix {
+	case "npub":
+		return data.(string), nil
+	case "nprofile":
+		return data.(nostr.ProfilePointer).PublicKey, nil
+	default:
+		return "", fmt.Errorf("invalid public key '%s': expected npub, nprofile, hex or name@domain", arg)
+	}
+}
+
 func git(args ...string) (string, error) {
 	cmd := exec.Command("git", args...)
 	stderr := &bytes.Buffer{}
@@ -157,16 +373,111 @@ func git(args ...string) (string, error) {
 	return strings.TrimSpace(string(v)), err
 }
 
+var patchCommitRegex = regexp.MustCompile(`^From ([0-9a-f]{40}) `)
+
+// getEarliestUniqueCommit returns the root commit of the current branch, the oldest one if there are many
+func getEarliestUniqueCommit() string {
+	out, err := git("rev-list", "--max-parents=0", "HEAD")
+	if err != nil || out == "" {
+		return ""
+	}
+	roots := strings.Split(out, "\n")
+	return roots[len(roots)-1]
+}
+
+// getCommitTags reads the commit a patch was generated from and returns the NIP-34 tags describing it,
+// or nothing if we don't have that commit
+func getCommitTags(patch string) nostr.Tags {
+	match := patchCommitRegex.FindStringSubmatch(patch)
+	if len(match) == 0 {
+		return nil
+	}
+	commit := match[1]
+
+	out, err := git("log", "-1", "--format=%P%n%cn%n%ce%n%ct%n%cd", "--date=format:%z", commit)
+	if err != nil {
+		return nil
+	}
+	lines := strings.Split(out, "\n")
+	if len(lines) != 5 {
+		return nil
+	}
+
+	tags := nostr.Tags{nostr.Tag{"commit", commit}}
+	if parents := strings.Fields(lines[0]); len(parents) > 0 {
+		tags = append(tags, nostr.Tag{"parent-commit", parents[0]})
+	}
+	if euc := getEarliestUniqueCommit(); euc != "" {
+		tags = append(tags, nostr.Tag{"r", euc})
+	}
+	tags = append(tags, nostr.Tag{"committer", lines[1], lines[2], lines[3], strconv.Itoa(timezoneMinutes(lines[4]))})
+	return tags
+}
+
+// timezoneMinutes turns "-0300" into -180
+func timezoneMinutes(tz string) int {
+	if len(tz) != 5 {
+		return 0
+	}
+	hours, _ := strconv.Atoi(tz[1:3])
+	minutes, _ := strconv.Atoi(tz[3:5])
+	offset := hours*60 + minutes
+	if tz[0] == '-' {
+		return -offset
+	}
+	return offset
+}
+
+// hasCommit tells if the given commit exists in the local repository
+func hasCommit(commit string) bool {
+	_, err := git("cat-file", "-e", commit+"^{commit}")
+	return err == nil
+}
+
 func sprintRepository(repo *nostr.Event) string {
+	bold := color.New(color.Bold)
+	field := func(name string, values ...string) string {
+		values = filterSlice(values, func(v string) bool { return v != "" })
+		if len(values) == 0 {
+			return ""
+		}
+		return "\n  " + bold.Sprint(name+": ") + strings.Join(values, " ")
+	}
+	tagValues := func(name string) []string {
+		values := make([]string, 0, 3)
+		for _, tag := range repo.Tags.GetAll([]string{name, ""}) {
+			values = append(values, tag[1:]...)
+		}
+		return values
+	}
+
 	res := ""
 	npub, _ := nip19.EncodePublicKey(repo.PubKey)
-	res += "\n  author: " + npub
-	res += "\n  id: " + (*repo.Tags.GetFirst([]string{"d", ""}))[1]
+	res += field("id", tagValues("d")...)
+	res += field("name", tagValues("name")...)
+	res += field("description", tagValues("description")...)
+	res += field("author", npub)
+
+	maintainers := tagValues("maintainers")
+	for i, pk := range maintainers {
+		if npub, err := nip19.EncodePublicKey(pk); err == nil {
+			maintainers[i] = npub
+		}
+	}
+	res += field("maintainers", maintainers...)
+	res += field("clone", tagValues("clone")...)
+	res += field("web", tagValues("web")...)
+	res += field("relays", getRepositoryRelays(repo)...)
+	if tag := repo.Tags.GetFirst([]string{"r", ""}); tag != nil {
+		res += field("earliest unique commit", (*tag)[1])
+	}
+	res += field("announced", humanAgo(repo.CreatedAt))
 	res += "\n"
-	// TODO: more stuff
-	return color.New(color.Bold).Sprint(res)
+	return res
 }
 
+// sprintPatch renders a patch we're about to publish with its header and colored diff, `git str show` is
+// what renders them along with their review comments
 func sprintPatch(patch *nostr.Event) string {
 	res := ""
 	npub, _ := nip19.EncodePublicKey(patch.PubKey)
@@ -181,14 +492,180 @@ func sprintPatch(patch *nostr.Event) string {
 		res += "\n  target repo: " + targetId
 		res += "\n  target author: " + targetNpub
 	}
-	// TODO: more stuff
+	if tag := patch.Tags.GetFirst([]string{"parent-commit", ""}); tag != nil {
+		res += "\n  parent commit: " + (*tag)[1]
+	}
 
 	res = color.New(color.Bold).Sprint(res)
-	res += "\n\n" + patch.Content
-	// TODO: colors
+	res += "\n\n"
+	res += sprintDiff(patch.Content, nil, nil)
+	return res
+}
+
+// sprintDiff colors the patch contents like git does and places the review comments given below the lines
+// they refer to, names are used for the comment authors when available
+func sprintDiff(content string, names map[string]string, comments []*nostr.Event) string {
+	inline := make(map[string][]*nostr.Event, len(comments))
+	general := make([]*nostr.Event, 0, len(comments))
+	for _, comment := range comments {
+		if location := getCommentLocation(comment); location != "" {
+			inline[location] = append(inline[location], comment)
+		} else {
+			general = append(general, comment)
+		}
+	}
+
+	res := ""
+	pw := &patchWalker{}
+	inDiff := false
+	printed := "" // removed lines don't move pw.line, so this keeps comments from repeating after each of them
+	for _, line := range strings.Split(content, "\n") {
+		pw.next(line)
+		if strings.HasPrefix(line, "diff --git ") {
+			inDiff = true
+		}
+		switch {
+		case !inDiff:
+			res += line + "\n"
+		case hunkHeaderRegex.MatchString(line):
+			res += color.CyanString(line) + "\n"
+		case line == "-- ":
+			// signature separator, not a removed line
+			inDiff = false
+			res += line + "\n"
+		case pw.inHunk && strings.HasPrefix(line, "+"):
+			res += color.GreenString(line) + "\n"
+		case pw.inHunk && strings.HasPrefix(line, "-"):
+			res += color.RedString(line) + "\n"
+		case pw.inHunk && strings.HasPrefix(line, "\\"):
+			res += color.New(color.Faint).Sprint(line) + "\n"
+		case pw.inHunk && (strings.HasPrefix(line, " ") || line == ""):
+			res += line + "\n"
+		default:
+			// diff, index and ---/+++ lines, or the signature at the end
+			res += color.New(color.Bold).Sprint(line) + "\n"
+		}
+
+		if !pw.inHunk || hunkHeaderRegex.MatchString(line) {
+			continue
+		}
+		location := pw.file + ":" + strconv.Itoa(pw.line)
+		if location == printed {
+			continue
+		}
+		printed = location
+		for _, comment := range inline[location] {
+			res += sprintComment(comment, names[comment.PubKey], "    ")
+		}
+	}
+	for _, comment := range general {
+		res += sprintComment(comment, names[comment.PubKey], "    ")
+	}
+
 	return res
 }
 
+// getCommentLocation returns "file:line" for review comments, line being the last line they refer to
+func getCommentLocation(comment *nostr.Event) string {
+	file := comment.Tags.GetFirst([]string{"file", ""})
+	lines := comment.Tags.GetFirst([]string{"lines", ""})
+	if file == nil || lines == nil || len(*lines) < 3 {
+		return ""
+	}
+	return (*file)[1] + ":" + (*lines)[2]
+}
+
+// sprintComment renders a reply with its author name (or a shortened npub if empty) and date
+func sprintComment(comment *nostr.Event, name string, indent string) string {
+	if name == "" {
+		npub, _ := nip19.EncodePublicKey(comment.PubKey)
+		name = npub[0:16]
+	}
+	res := indent + color.New(color.Bold).Sprintf("┌ %s, %s", name, humanDate(comment.CreatedAt)) + "\n"
+	// skip the quote, we're already showing it
+	lines := filterSlice(strings.Split(comment.Content, "\n"), func(line string) bool {
+		return !strings.HasPrefix(line, ">")
+	})
+	for _, line := range strings.Split(strings.TrimSpace(strings.Join(lines, "\n")), "\n") {
+		res += indent + color.YellowString("│ ") + line + "\n"
+	}
+	return res
+}
+
+func sprintIssue(issue *nostr.Event) string {
+	res := ""
+	npub, _ := nip19.EncodePublicKey(issue.PubKey)
+	res += "\n  id: " + issue.ID
+	res += "\n  author: " + npub
+	res += "\n  date: " + humanDate(issue.CreatedAt)
+	res += "\n  subject: " + getIssueSubject(issue)
+
+	res = color.New(color.Bold).Sprint(res)
+	res += "\n\n" + issue.Content
+	return res
+}
+
+func getIssueSubject(issue *nostr.Event) string {
+	if tag := issue.Tags.GetFirst([]string{"subject", ""}); tag != nil {
+		return (*tag)[1]
+	}
+	subject, _, _ := strings.Cut(strings.TrimSpace(issue.Content), "\n")
+	return subject
+}
+
+// parseTime reads either a date like 2024-01-31 or a duration like 72h or 10d into a timestamp,
+// durations are counted backwards from now
+func parseTime(str string) (nostr.Timestamp, error) {
+	if t, err := time.Parse(time.DateOnly, str); err == nil {
+		return nostr.Timestamp(t.Unix()), nil
+	}
+	if strings.HasSuffix(str, "d") {
+		if days, err := strconv.Atoi(strings.TrimSuffix(str, "d")); err == nil {
+			return nostr.Timestamp(time.Now().AddDate(0, 0, -days).Unix()), nil
+		}
+	}
+	if d, err := time.ParseDuration(str); err == nil {
+		return nostr.Timestamp(time.Now().Add(-d).Unix()), nil
+	}
+	return 0, fmt.Errorf("invalid time '%s', expected a date like 2006-01-02 or a duration like 10d", str)
+}
+
+// fetchDisplayNames gets the names of the given pubkeys from their kind 0 metadata, falling back to a
+// shortened npub for those we can't find
+func fetchDisplayNames(ctx context.Context, relays []string, pubkeys []string) map[string]string {
+	names := make(map[string]string, len(pubkeys))
+	for _, pk := range pubkeys {
+		npub, _ := nip19.EncodePublicKey(pk)
+		names[pk] = npub[0:16]
+	}
+	if len(pubkeys) == 0 {
+		return names
+	}
+
+	latest := make(map[string]nostr.Timestamp, len(pubkeys))
+	for _, evt := range queryEvents(ctx, concatSlices(relays, profileRelays), nostr.Filter{
+		Kinds:   []int{nostr.KindProfileMetadata},
+		Authors: pubkeys,
+	}) {
+		if evt.CreatedAt <= latest[evt.PubKey] {
+			continue
+		}
+		var meta struct {
+			Name        string `json:"name"`
+			DisplayName string `json:"display_name"`
+		}
+		if err := json.Unmarshal([]byte(evt.Content), &meta); err != nil {
+			continue
+		}
+		if name := valueOr(meta.DisplayName, meta.Name); name != "" {
+			names[evt.PubKey] = name
+			latest[evt.PubKey] = evt.CreatedAt
+		}
+	}
+
+	return names
+}
+
 func humanDate(createdAt nostr.Timestamp) string {
 	ts := createdAt.Time()
 	now := time.Now()
@@ -201,9 +678,57 @@ func humanDate(createdAt nostr.Timestamp) string {
 	}
 }
 
-func confirm(msg string) bool {
+// humanAgo says how long ago something happened, like "3 days ago"
+func humanAgo(createdAt nostr.Timestamp) string {
+	elapsed := time.Since(createdAt.Time())
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %s ago", unit)
+		}
+		return fmt.Sprintf("%d %ss ago", n, unit)
+	}
+	switch {
+	case elapsed < time.Minute:
+		return "just now"
+	case elapsed < time.Hour:
+		return plural(int(elapsed.Minutes()), "minute")
+	case elapsed < 24*time.Hour:
+		return plural(int(elapsed.Hours()), "hour")
+	case elapsed < 60*24*time.Hour:
+		return plural(int(elapsed.Hours()/24), "day")
+	case elapsed < 2*365*24*time.Hour:
+		return plural(int(elapsed.Hours()/24/30), "month")
+	default:
+		return plural(int(elapsed.Hours()/24/365), "year")
+	}
+}
+
+// confirm asks a yes or no question, the answer is always yes with --yes and it's an error to ask otherwise
+// when we can't prompt
+func confirm(msg string) (bool, error) {
+	if assumeYes {
+		logf("%s(assuming yes with --yes)\n", msg)
+		return true, nil
+	}
+	if !interactive() {
+		return false, fmt.Errorf("can't confirm '%s' in non-interactive mode, use --yes", strings.TrimSpace(msg))
+	}
+	return askYesNo(msg)
+}
+
+// confirmOptional asks about something we can do without, like storing a value for later, so the answer
+// is always no with --yes or when we can't prompt
+func confirmOptional(msg string) bool {
+	if assumeYes || !interactive() {
+		return false
+	}
+	res, _ := askYesNo(msg)
+	return res
+}
+
+func askYesNo(msg string) (bool, error) {
 	var res bool
-	ask(msg+"(y/n) ", "", func(answer string) bool {
+	_, err := ask(msg+"(y/n) ", "", func(answer string) bool {
 		switch answer {
 		case "y", "yes":
 			res = true
@@ -215,10 +740,13 @@ func confirm(msg string) bool {
 			return true
 		}
 	})
-	return res
+	return res, err
 }
 
 func promptDecrypt(ncryptsec1 string) (string, error) {
+	if !interactive() {
+		return "", fmt.Errorf("can't ask for the password of an ncryptsec key in non-interactive mode, give the key decrypted with --sec")
+	}
 	for i := 1; i < 4; i++ {
 		var attemptStr string
 		if i > 1 {
@@ -246,6 +774,9 @@ func ask(msg string, defaultValue string, shouldAskAgain func(answer string) boo
 }
 
 func askPassword(msg string, shouldAskAgain func(answer string) bool) (string, error) {
+	if !interactive() {
+		return "", fmt.Errorf("can't ask for a password in non-interactive mode")
+	}
 	config := &readline.Config{
 		Prompt:                 color.CyanString(msg),
 		InterruptPrompt:        "^C",
@@ -257,6 +788,14 @@ func askPassword(msg string, shouldAskAgain func(answer string) bool) (string, e
 }
 
 func _ask(config *readline.Config, msg string, defaultValue string, shouldAskAgain func(answer string) bool) (string, error) {
+	if !interactive() {
+		// can't prompt, so take the default if it's a valid answer
+		if shouldAskAgain != nil && shouldAskAgain(defaultValue) {
+			return "", fmt.Errorf("can't ask '%s' in non-interactive mode, use flags or `git config` to give it", strings.TrimSpace(msg))
+		}
+		return defaultValue, nil
+	}
+
 	rl, err := readline.NewEx(config)
 	if err != nil {
 		return "", err
@@ -304,6 +843,10 @@ func filterSlice[V any](slice []V, keep func(v V) bool) []V {
 }
 
 func edit(initial string) (string, error) {
+	if !interactive() {
+		return "", fmt.Errorf("can't open an editor in non-interactive mode, use flags to give the text")
+	}
+
 	editor := "vim"
 	if s := os.Getenv("EDITOR"); s != "" {
 		editor = s
@@ -339,6 +882,34 @@ func edit(initial string) (string, error) {
 	return string(b), nil
 }
 
+// page writes the text to stdout, through the pager git would use if stdout is a terminal
+func page(text string) error {
+	if stat, _ := os.Stdout.Stat(); stat.Mode()&os.ModeCharDevice == 0 {
+		fmt.Print(text)
+		return nil
+	}
+
+	pager, _ := git("var", "GIT_PAGER")
+	if pager == "" || pager == "cat" {
+		fmt.Print(text)
+		return nil
+	}
+
+	cmd := exec.Command("sh", "-c", pager)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	if os.Getenv("LESS") == "" {
+		// same defaults git uses, so colors work and short outputs don't wait for a keypress
+		cmd.Env = append(cmd.Env, "LESS=FRX")
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("executing pager '%s': %w", pager, err)
+	}
+	return nil
+}
+
 func split(str string) []string {
 	res := make([]string, 0, 5)
 	for _, v := range strings.Split(str, " ") {
@@ -351,3 +922,10 @@ func split(str string) []string {
 	}
 	return res
 }
+
+func valueOr(v string, fallback string) string {
+	if v == "" {
+		return fallback
+	}
+	return v
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/nbd-wtf/go-nostr"
@@ -50,6 +51,10 @@ var initRepo = &cli.Command{
 			Name:  "web-url",
 			Usage: "URL through which this repository can be browsed on the web",
 		},
+		&cli.StringSliceFlag{
+			Name:  "maintainer",
+			Usage: "other people who maintain this repository and publish their own announcements with the same id, as npub, hex or name@domain",
+		},
 	},
 	Action: func(ctx context.Context, c *cli.Command) error {
 		evt := nostr.Event{
@@ -91,6 +96,9 @@ var initRepo = &cli.Command{
 				if v == "" {
 					v = prop.deflt
 				}
+				if v == "" && !prop.optional && !interactive() {
+					return fmt.Errorf("'%s' is mandatory, give it with --%s", prop.name, prop.name)
+				}
 
 				prompt := prop.prompt
 				if prop.optional {
@@ -127,56 +135,64 @@ var initRepo = &cli.Command{
 			}
 		}
 
-		bunker, sec, isEncrypted, err := gatherSecretKeyOrBunker(ctx, c)
-		if err != nil {
-			return fmt.Errorf("failed to get authentication data: %w", err)
+		maintainers := c.StringSlice("maintainer")
+		if len(maintainers) == 0 {
+			stored, _ := git("config", "--local", "str.maintainers")
+			maintainers = split(stored)
 		}
-
-		if isEncrypted {
-			sec, err = promptDecrypt(sec)
-			if err != nil {
-				return err
+		if len(maintainers) > 0 {
+			tag := nostr.Tag{"maintainers"}
+			for _, maintainer := range maintainers {
+				pk, err := parsePublicKey(ctx, maintainer)
+				if err != nil {
+					return err
+				}
+				tag = append(tag, pk)
 			}
+			git("config", "--local", "str.maintainers", strings.Join(tag[1:], " "))
+			evt.Tags = append(evt.Tags, tag)
 		}
 
-		if bunker != nil {
-			err = bunker.SignEvent(ctx, &evt)
-			if err != nil {
-				return fmt.Errorf("error signing event with bunker: %w", err)
-			}
-		} else {
-			err = evt.Sign(sec)
-			if err != nil {
-				return fmt.Errorf("error signing event with key: %w", err)
-			}
+		if euc := getEarliestUniqueCommit(); euc != "" {
+			evt.Tags = append(evt.Tags, nostr.Tag{"r", euc, "euc"})
 		}
 
-		git("config", "--local", "str.publickey", evt.PubKey)
-
-		relays := c.StringSlice("relay")
-		successRelays := make([]string, 0, len(relays))
-		for _, r := range relays {
-			logf("publishing to %s...", r)
-			if relay, err := pool.EnsureRelay(r); err == nil {
-				if err := relay.Publish(ctx, evt); err != nil {
-					logf(" failed: %s\n", err)
-				} else {
-					logf("done\n")
-					successRelays = append(successRelays, r)
+		// keep whatever other clients have added to a previous announcement
+		if pk := getRepositoryPublicKey(); pk != "" {
+			id := (*evt.Tags.GetFirst([]string{"d", ""}))[1]
+			if existing := fetchRepository(ctx, nostr.EntityPointer{
+				PublicKey:  pk,
+				Kind:       RepoAnnouncementKind,
+				Identifier: id,
+			}, concatSlices(c.StringSlice("relay"), getPatchRelays())); existing != nil {
+				for _, tag := range existing.Tags {
+					if len(tag) > 0 && !isManagedTag(tag[0]) {
+						logf("keeping tag %v from the existing announcement\n", tag)
+						evt.Tags = append(evt.Tags, tag)
+					}
 				}
-			} else {
-				logf(" failed: %s\n", err)
+				evt.CreatedAt = max(evt.CreatedAt, existing.CreatedAt+1)
 			}
 		}
 
-		if len(successRelays) > 0 {
-			tag := evt.Tags.GetFirst([]string{"d", ""})
-			naddr, _ := nip19.EncodeEntity(evt.PubKey, RepoAnnouncementKind, (*tag)[1], successRelays)
-			fmt.Println(naddr)
-			return nil
-		} else {
-			fmt.Println(evt)
+		sign, err := gatherSigner(ctx, c)
+		if err != nil {
+			return err
+		}
+		if err := sign(&evt); err != nil {
+			return err
+		}
+
+		successRelays := publish(ctx, evt, c.StringSlice("relay"))
+		tag := evt.Tags.GetFirst([]string{"d", ""})
+		naddr, _ := nip19.EncodeEntity(evt.PubKey, RepoAnnouncementKind, (*tag)[1], successRelays)
+		printPublished(evt, naddr, successRelays, c.StringSlice("relay"))
+		if len(successRelays) == 0 {
 			return fmt.Errorf("couldn't publish the event to any relays, use -r or --relay to specify some relays")
 		}
+
+		git("config", "--local", "str.publickey", evt.PubKey)
+		git("config", "--local", "str.announced-at", strconv.FormatInt(int64(evt.CreatedAt), 10))
+		return nil
 	},
 }
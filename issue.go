@@ -0,0 +1,226 @@
+package gitstr
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+	"github.com/urfave/cli/v3"
+)
+
+var issue = &cli.Command{
+	Name:        "issue",
+	Usage:       "publish and browse issues for a repository",
+	Description: "",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:       "to",
+			Aliases:    []string{"a", "repository"},
+			Usage:      "repository reference, as an naddr1... code",
+			Persistent: true,
+		},
+		&cli.StringSliceFlag{
+			Name:       "relay",
+			Aliases:    []string{"r"},
+			Usage:      "extra relays to search for the repository and issues in",
+			Persistent: true,
+		},
+	},
+	Commands: []*cli.Command{
+		{
+			Name:      "new",
+			UsageText: "git str issue new [--subject <subject>] [--body <body>]",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "sec",
+					Usage:   "secret key to sign the issue, as hex or nsec, or bunker:// URL, or a NIP-46-powered name@domain",
+					Aliases: []string{"connect"},
+				},
+				&cli.StringFlag{
+					Name:    "subject",
+					Aliases: []string{"s"},
+					Usage:   "issue subject, if not given it will be taken from the first line of the text typed on the editor",
+				},
+				&cli.StringFlag{
+					Name:    "body",
+					Aliases: []string{"m"},
+					Usage:   "issue body, if not given an editor will be opened",
+				},
+				&cli.StringSliceFlag{
+					Name:    "label",
+					Aliases: []string{"t"},
+					Usage:   "hashtags to label the issue with",
+				},
+			},
+			Action: func(ctx context.Context, c *cli.Command) error {
+				subject := c.String("subject")
+				body := c.String("body")
+				if body == "" && !interactive() {
+					return fmt.Errorf("no issue text, give it with --body and --subject")
+				}
+				if body == "" {
+					text, err := edit(subject + "\n\n")
+					if err != nil {
+						return fmt.Errorf("error writing issue: %w", err)
+					}
+					subject, body, _ = strings.Cut(strings.TrimSpace(text), "\n")
+					subject = strings.TrimSpace(subject)
+					body = strings.TrimSpace(body)
+				}
+				if subject == "" {
+					return fmt.Errorf("issue subject is empty, aborting")
+				}
+
+				evt := &nostr.Event{
+					CreatedAt: nostr.Now(),
+					Kind:      IssueKind,
+					Content:   body,
+					Tags: nostr.Tags{
+						nostr.Tag{"alt", "a git issue: " + subject},
+						nostr.Tag{"subject", subject},
+					},
+				}
+				for _, label := range c.StringSlice("label") {
+					evt.Tags = append(evt.Tags, nostr.Tag{"t", label})
+				}
+
+				relays, err := getAndApplyTargetRepository(ctx, c, []*nostr.Event{evt}, c.StringSlice("relay"))
+				if err != nil {
+					return err
+				}
+				relays = append(relays, c.StringSlice("relay")...)
+				if len(relays) == 0 {
+					return fmt.Errorf("got no relays to publish to, you can specify one with --relay/-r")
+				}
+
+				sign, err := gatherSigner(ctx, c)
+				if err != nil {
+					return err
+				}
+				if err := sign(evt); err != nil {
+					return err
+				}
+
+				logf("\n%s\n\n", sprintIssue(evt))
+				if ok, err := confirm("proceed to publish the event? "); err != nil {
+					return err
+				} else if !ok {
+					return nil
+				}
+
+				goodRelays := publish(ctx, *evt, relays)
+				code, _ := nip19.EncodeEvent(evt.ID, goodRelays, evt.PubKey)
+				printPublished(*evt, code, goodRelays, relays)
+				if len(goodRelays) == 0 {
+					return fmt.Errorf("didn't publish the event")
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "list",
+			UsageText: "git str issue list",
+			Flags: []cli.Flag{
+				&cli.IntFlag{
+					Name:    "limit",
+					Aliases: []string{"l"},
+					Value:   30,
+				},
+			},
+			Action: func(ctx context.Context, c *cli.Command) error {
+				ep, err := getRepositoryPointer(c)
+				if err != nil {
+					return err
+				}
+
+				relays := concatSlices(ep.Relays, c.StringSlice("relay"))
+				if repo := fetchRepository(ctx, ep, c.StringSlice("relay")); repo != nil {
+					relays = append(relays, getRepositoryRelays(repo.Event)...)
+				}
+
+				issues := queryEvents(ctx, relays, nostr.Filter{
+					Kinds: []int{IssueKind},
+					Tags: nostr.TagMap{
+						"a": []string{fmt.Sprintf("%d:%s:%s", ep.Kind, ep.PublicKey, ep.Identifier)},
+					},
+					Limit: int(c.Int("limit")),
+				})
+
+				statuses := fetchStatuses(ctx, relays, issues)
+				if jsonOutput {
+					infos := make([]issueInfo, len(issues))
+					for i, evt := range issues {
+						infos[i] = newIssueInfo(evt, statuses[evt.ID])
+					}
+					printJSON(infos)
+					return nil
+				}
+				for _, evt := range issues {
+					nevent, _ := nip19.EncodeEvent(evt.ID, nil, "")
+					npub, _ := nip19.EncodePublicKey(evt.PubKey)
+					fmt.Printf("%s %s [%s] %s %s\n",
+						color.New(color.Faint).Sprint(humanDate(evt.CreatedAt)),
+						nevent,
+						sprintStatus(statuses[evt.ID]),
+						color.New(color.Bold).Sprint(getIssueSubject(evt)),
+						color.New(color.Faint).Sprint(npub[0:16]),
+					)
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "show",
+			UsageText: "git str issue show <nevent>",
+			Action: func(ctx context.Context, c *cli.Command) error {
+				ep, err := parseEventPointer(c.Args().First())
+				if err != nil {
+					return err
+				}
+
+				relays := concatSlices(ep.Relays, c.StringSlice("relay"))
+				if rep, err := getRepositoryPointer(c); err == nil {
+					relays = append(relays, rep.Relays...)
+				}
+
+				ie := querySingle(ctx, relays, nostr.Filter{IDs: []string{ep.ID}})
+				if ie == nil {
+					return fmt.Errorf("couldn't find issue %s", ep.ID)
+				}
+				if ie.Kind != IssueKind {
+					return fmt.Errorf("event %s is not an issue (kind %d)", ep.ID, ie.Kind)
+				}
+
+				statuses := fetchStatuses(ctx, relays, []*nostr.Event{ie.Event})
+				if jsonOutput {
+					printJSON(newIssueInfo(ie.Event, statuses[ie.ID]))
+					return nil
+				}
+				fmt.Println(sprintIssue(ie.Event))
+				fmt.Println("\n" + color.New(color.Bold).Sprint("status: ") + sprintStatus(statuses[ie.ID]))
+				return nil
+			},
+		},
+	},
+}
+
+// issueInfo is how issues are shown with --json
+type issueInfo struct {
+	Nevent  string       `json:"nevent"`
+	Subject string       `json:"subject"`
+	Status  string       `json:"status"`
+	Event   *nostr.Event `json:"event"`
+}
+
+func newIssueInfo(issue *nostr.Event, status *nostr.Event) issueInfo {
+	nevent, _ := nip19.EncodeEvent(issue.ID, nil, "")
+	return issueInfo{
+		Nevent:  nevent,
+		Subject: getIssueSubject(issue),
+		Status:  statusName(status),
+		Event:   issue,
+	}
+}
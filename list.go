@@ -0,0 +1,232 @@
+package gitstr
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/fatih/color"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+	"github.com/urfave/cli/v3"
+)
+
+var list = &cli.Command{
+	Name:        "list",
+	Usage:       "list incoming patch series with their status",
+	Description: "",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "to",
+			Aliases: []string{"a", "repository"},
+			Usage:   "repository reference, as an naddr1... code",
+		},
+		&cli.StringSliceFlag{
+			Name:    "relay",
+			Aliases: []string{"r"},
+			Usage:   "extra relays to search for patches in",
+		},
+		&cli.IntFlag{
+			Name:    "limit",
+			Aliases: []string{"l"},
+			Value:   100,
+			Usage:   "maximum number of patches to fetch",
+		},
+		&cli.StringSliceFlag{
+			Name:  "author",
+			Usage: "only show series from these authors, as npub, hex or name@domain",
+		},
+		&cli.StringFlag{
+			Name:  "since",
+			Usage: "only show series updated after this date (2006-01-02) or within this duration (10d, 48h)",
+		},
+		&cli.StringSliceFlag{
+			Name:  "state",
+			Usage: "only show series with these statuses (open, applied, closed, draft)",
+		},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		ep, err := getRepositoryPointer(c)
+		if err != nil {
+			return err
+		}
+
+		// patches may be addressed to any of the maintainers' announcements
+		relays := concatSlices(ep.Relays, c.StringSlice("relay"))
+		repos := fetchMaintainerRepositories(ctx, ep, c.StringSlice("relay"))
+		for _, repo := range repos {
+			relays = append(relays, getRepositoryRelays(repo)...)
+		}
+
+		filter := nostr.Filter{
+			Kinds: []int{PatchKind},
+			Tags: nostr.TagMap{
+				"a": getRepositoryAddresses(ep, repos),
+			},
+			Limit: int(c.Int("limit")),
+		}
+		for _, author := range c.StringSlice("author") {
+			pk, err := parsePublicKey(ctx, author)
+			if err != nil {
+				return err
+			}
+			filter.Authors = append(filter.Authors, pk)
+		}
+		if len(filter.Authors) > 0 {
+			relays = append(relays, getOutboxRelays(ctx, relays, filter.Authors)...)
+		}
+		if since := c.String("since"); since != "" {
+			ts, err := parseTime(since)
+			if err != nil {
+				return err
+			}
+			filter.Since = &ts
+		}
+		for _, state := range c.StringSlice("state") {
+			if _, ok := statusKinds[state]; !ok {
+				return fmt.Errorf("invalid state '%s', expected one of applied, closed, draft or open", state)
+			}
+		}
+
+		events := queryEvents(ctx, relays, filter)
+
+		allSeries := groupSeries(events)
+		statuses := fetchStatuses(ctx, relays, events)
+
+		authors := make([]string, 0, len(allSeries))
+		for _, series := range allSeries {
+			authors = append(authors, series.author)
+		}
+		slices.Sort(authors)
+		names := fetchDisplayNames(ctx, relays, slices.Compact(authors))
+
+		results := make([]seriesInfo, 0, len(allSeries))
+		for _, series := range allSeries {
+			status := statuses[series.rootID]
+			if states := c.StringSlice("state"); len(states) > 0 && !slices.Contains(states, statusName(status)) {
+				continue
+			}
+
+			latest := series.latest()
+			nevent, _ := nip19.EncodeEvent(latest.rootID, nil, "")
+			subject := "(first patch not found)"
+			if latest.root != nil {
+				subject = getPatchSubject(latest.root)
+			}
+			count := fmt.Sprintf("%d patch", len(latest.patches))
+			if len(latest.patches) > 1 {
+				count += "es"
+			}
+			if len(series.revisions) > 0 {
+				count += fmt.Sprintf(", %d revisions", len(series.revisions)+1)
+			}
+
+			if jsonOutput {
+				results = append(results, seriesInfo{
+					Nevent:     nevent,
+					ID:         latest.rootID,
+					Subject:    subject,
+					Status:     statusName(status),
+					Author:     series.author,
+					AuthorName: names[series.author],
+					Patches:    len(latest.patches),
+					Revisions:  len(series.revisions) + 1,
+					UpdatedAt:  series.updatedAt,
+				})
+				continue
+			}
+
+			fmt.Printf("%s %s [%s] %s %s %s\n",
+				color.New(color.Faint).Sprint(humanDate(series.updatedAt)),
+				nevent,
+				sprintStatus(status),
+				color.New(color.Bold).Sprint(subject),
+				color.New(color.Faint).Sprint("("+count+")"),
+				color.CyanString(names[series.author]),
+			)
+		}
+
+		if jsonOutput {
+			printJSON(results)
+		}
+		return nil
+	},
+}
+
+// seriesInfo is how each series is shown with --json
+type seriesInfo struct {
+	Nevent     string          `json:"nevent"`
+	ID         string          `json:"id"`
+	Subject    string          `json:"subject"`
+	Status     string          `json:"status"`
+	Author     string          `json:"author"`
+	AuthorName string          `json:"author_name"`
+	Patches    int             `json:"patches"`
+	Revisions  int             `json:"revisions"`
+	UpdatedAt  nostr.Timestamp `json:"updated_at"`
+}
+
+type patchSeries struct {
+	rootID    string
+	root      *nostr.Event
+	author    string
+	patches   []*nostr.Event
+	revisions []*patchSeries
+	updatedAt nostr.Timestamp
+}
+
+// latest returns the latest revision of the series, or the series itself if it has never been revised
+func (series *patchSeries) latest() *patchSeries {
+	if len(series.revisions) == 0 {
+		return series
+	}
+	return series.revisions[len(series.revisions)-1]
+}
+
+// groupSeries puts together patches that belong to the same thread and revisions of the same series,
+// newest series first
+func groupSeries(events []*nostr.Event) []*patchSeries {
+	byRoot := make(map[string]*patchSeries, len(events))
+	result := make([]*patchSeries, 0, len(events))
+	for _, evt := range events {
+		rootID := getThreadRootID(evt)
+		series, ok := byRoot[rootID]
+		if !ok {
+			series = &patchSeries{rootID: rootID, author: evt.PubKey}
+			byRoot[rootID] = series
+			result = append(result, series)
+		}
+		if evt.ID == rootID {
+			series.root = evt
+			series.author = evt.PubKey
+		}
+		series.patches = append(series.patches, evt)
+		if evt.CreatedAt > series.updatedAt {
+			series.updatedAt = evt.CreatedAt
+		}
+	}
+
+	// revisions go inside the series they revise
+	result = slices.DeleteFunc(result, func(series *patchSeries) bool {
+		if series.root == nil {
+			return false
+		}
+		original, ok := byRoot[getRevisedRootID(series.root)]
+		if !ok {
+			return false
+		}
+		original.revisions = append(original.revisions, series)
+		if series.updatedAt > original.updatedAt {
+			original.updatedAt = series.updatedAt
+		}
+		return true
+	})
+	for _, series := range result {
+		slices.SortFunc(series.revisions, func(a, b *patchSeries) int {
+			return getPatchVersion(a.root) - getPatchVersion(b.root)
+		})
+	}
+
+	slices.SortFunc(result, func(a, b *patchSeries) int { return int(b.updatedAt - a.updatedAt) })
+	return result
+}
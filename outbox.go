@@ -0,0 +1,211 @@
+package gitstr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/urfave/cli/v3"
+)
+
+// outboxEntry is a signed event that couldn't be published to some relays, kept at .git/str/outbox/<id>.json
+// so it isn't lost and can be retried later
+type outboxEntry struct {
+	Event  nostr.Event               `json:"event"`
+	Relays map[string]*deliveryState `json:"relays"`
+}
+
+type deliveryState struct {
+	Delivered   bool            `json:"delivered"`
+	Attempts    int             `json:"attempts"`
+	LastAttempt nostr.Timestamp `json:"last_attempt"`
+	Error       string          `json:"error,omitempty"`
+}
+
+// nextAttempt doubles the wait after each failure, starting at one minute and up to a day
+func (ds *deliveryState) nextAttempt() nostr.Timestamp {
+	wait := time.Minute << min(max(ds.Attempts-1, 0), 11)
+	return ds.LastAttempt + nostr.Timestamp(min(wait, 24*time.Hour).Seconds())
+}
+
+func (entry *outboxEntry) pending() bool {
+	for _, ds := range entry.Relays {
+		if !ds.Delivered {
+			return true
+		}
+	}
+	return false
+}
+
+var outboxCmd = &cli.Command{
+	Name:        "outbox",
+	Usage:       "list and retry events that couldn't be published",
+	Description: "events that fail to reach some of their relays are kept on .git/str/outbox/ and retried automatically, with increasing intervals, whenever a command is called",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "retry",
+			Usage: "try to publish all pending events now, regardless of when they were last tried",
+		},
+		&cli.StringSliceFlag{
+			Name:  "drop",
+			Usage: "give up on publishing these events, by id",
+		},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		if getStore() == nil {
+			return fmt.Errorf("not inside a git repository")
+		}
+
+		for _, id := range c.StringSlice("drop") {
+			if !nostr.IsValid32ByteHex(id) {
+				return fmt.Errorf("invalid event id '%s'", id)
+			}
+			if err := os.Remove(outboxPath(id)); err != nil {
+				return fmt.Errorf("failed to drop '%s': %w", id, err)
+			}
+			logf("dropped %s\n", id)
+		}
+
+		if c.Bool("retry") {
+			flushOutbox(ctx, true)
+		}
+
+		entries := loadOutbox()
+		if jsonOutput {
+			printJSON(entries)
+			return nil
+		}
+		if len(entries) == 0 {
+			logf("outbox is empty\n")
+			return nil
+		}
+		for _, entry := range entries {
+			fmt.Printf("%s %s %s\n",
+				entry.Event.ID,
+				color.New(color.Faint).Sprintf("kind %d,", entry.Event.Kind),
+				color.New(color.Faint).Sprint(humanDate(entry.Event.CreatedAt)),
+			)
+			for _, url := range sortedKeys(entry.Relays) {
+				ds := entry.Relays[url]
+				if ds.Delivered {
+					fmt.Printf("  %s %s\n", color.GreenString("delivered"), url)
+					continue
+				}
+				fmt.Printf("  %s %s %s\n", color.YellowString("pending"), url,
+					color.New(color.Faint).Sprintf("(%d attempts, next %s: %s)",
+						ds.Attempts, humanDate(ds.nextAttempt()), ds.Error))
+			}
+		}
+		return nil
+	},
+}
+
+func outboxPath(id string) string {
+	return filepath.Join(getStore().dir, "outbox", id+".json")
+}
+
+// enqueue records the delivery state of an event we just tried to publish, only keeping it if some relay failed
+func enqueue(evt nostr.Event, delivered []string, failed map[string]error) {
+	if getStore() == nil || len(failed) == 0 {
+		return
+	}
+
+	entry := &outboxEntry{Event: evt, Relays: make(map[string]*deliveryState, len(delivered)+len(failed))}
+	now := nostr.Now()
+	for _, url := range delivered {
+		entry.Relays[url] = &deliveryState{Delivered: true, Attempts: 1, LastAttempt: now}
+	}
+	for url, err := range failed {
+		entry.Relays[url] = &deliveryState{Attempts: 1, LastAttempt: now, Error: err.Error()}
+	}
+	if err := saveOutboxEntry(entry); err != nil {
+		logf(color.RedString("failed to save event to outbox: %s\n"), err)
+		return
+	}
+	logf(color.YellowString("event kept on the outbox for %d relays, it will be retried later or with `git str outbox --retry`\n"),
+		len(failed))
+}
+
+func saveOutboxEntry(entry *outboxEntry) error {
+	path := outboxPath(entry.Event.ID)
+	if !entry.pending() {
+		os.Remove(path)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	b, _ := json.MarshalIndent(entry, "", "  ")
+	return os.WriteFile(path, b, 0644)
+}
+
+func loadOutbox() []*outboxEntry {
+	if getStore() == nil {
+		return nil
+	}
+	files, _ := filepath.Glob(filepath.Join(getStore().dir, "outbox", "*.json"))
+	entries := make([]*outboxEntry, 0, len(files))
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		var entry outboxEntry
+		if err := json.Unmarshal(b, &entry); err != nil || entry.Relays == nil {
+			logf(color.RedString("invalid outbox entry '%s'\n"), file)
+			continue
+		}
+		entries = append(entries, &entry)
+	}
+	slices.SortFunc(entries, func(a, b *outboxEntry) int { return int(a.Event.CreatedAt - b.Event.CreatedAt) })
+	return entries
+}
+
+// flushOutbox tries again to publish pending events to the relays that failed before, if force is false only
+// those whose backoff interval has passed are tried
+func flushOutbox(ctx context.Context, force bool) {
+	now := nostr.Now()
+	for _, entry := range loadOutbox() {
+		for url, ds := range entry.Relays {
+			if ds.Delivered || (!force && ds.nextAttempt() > now) {
+				continue
+			}
+
+			logf("publishing %s from outbox to %s...", entry.Event.ID[0:8], url)
+			ds.Attempts++
+			ds.LastAttempt = now
+			relay, err := pool.EnsureRelay(url)
+			if err == nil {
+				tctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+				err = publishToRelay(tctx, relay, entry.Event)
+				cancel()
+			}
+			if err != nil {
+				ds.Error = err.Error()
+				logf(" failed: %s\n", err)
+			} else {
+				ds.Delivered = true
+				ds.Error = ""
+				logf("done\n")
+			}
+		}
+		if err := saveOutboxEntry(entry); err != nil {
+			logf(color.RedString("failed to update outbox: %s\n"), err)
+		}
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
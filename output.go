@@ -0,0 +1,53 @@
+package gitstr
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// jsonOutput is set by the global --json flag: commands then print a single JSON value on stdout instead
+// of nip19 codes and text, progress still goes to stderr, and it implies --non-interactive
+var jsonOutput bool
+
+func printJSON(v any) {
+	b, _ := json.MarshalIndent(v, "", "  ")
+	fmt.Println(string(b))
+}
+
+// publishedEvent is how events we tried to publish are reported with --json
+type publishedEvent struct {
+	Event   nostr.Event `json:"event"`
+	Code    string      `json:"code,omitempty"`
+	Relays  []string    `json:"relays"`
+	Pending []string    `json:"pending,omitempty"`
+}
+
+func newPublishedEvent(evt nostr.Event, code string, relays []string, attempted []string) publishedEvent {
+	pending := make([]string, 0, len(attempted))
+	for _, url := range uniqueRelays(attempted) {
+		if !slices.Contains(relays, url) {
+			pending = append(pending, url)
+		}
+	}
+	if len(relays) == 0 {
+		code = ""
+	}
+	return publishedEvent{Event: evt, Code: code, Relays: append([]string{}, relays...), Pending: pending}
+}
+
+// printPublished reports an event we tried to publish to the given relays: the code that references it, or
+// the raw event if no relay accepted it
+func printPublished(evt nostr.Event, code string, relays []string, attempted []string) {
+	if jsonOutput {
+		printJSON(newPublishedEvent(evt, code, relays, attempted))
+		return
+	}
+	if len(relays) == 0 {
+		fmt.Println(evt)
+		return
+	}
+	fmt.Println(code)
+}
@@ -0,0 +1,98 @@
+package gitstr
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/urfave/cli/v3"
+)
+
+var rangeDiff = &cli.Command{
+	Name:        "range-diff",
+	Usage:       "compare two revisions of a patch series",
+	UsageText:   "git str range-diff <nevent-old> <nevent-new>",
+	Description: "both series are applied on temporary worktrees at the commit they declare as their base and then compared with `git range-diff`",
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:    "relay",
+			Aliases: []string{"r"},
+			Usage:   "extra relays to search for the patches in",
+		},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		if c.Args().Len() != 2 {
+			return fmt.Errorf("expected two nevent codes, one for each revision")
+		}
+
+		ranges := make([]string, 2)
+		for i, arg := range c.Args().Slice() {
+			series, err := fetchSeriesFromArg(ctx, arg, c.StringSlice("relay"))
+			if err != nil {
+				return err
+			}
+			if isCoverLetter(series[0]) {
+				series = series[1:]
+			}
+			if len(series) == 0 {
+				return fmt.Errorf("series %s has no patches besides the cover letter", arg)
+			}
+
+			base, tip, err := applyOnWorktree(series)
+			if err != nil {
+				return fmt.Errorf("failed to apply '%s': %w", getPatchSubject(series[0]), err)
+			}
+			ranges[i] = base + ".." + tip
+		}
+
+		if jsonOutput {
+			out, err := git("range-diff", "--no-color", ranges[0], ranges[1])
+			if err != nil {
+				return err
+			}
+			printJSON(map[string]string{"old": ranges[0], "new": ranges[1], "range_diff": out})
+			return nil
+		}
+
+		cmd := exec.CommandContext(ctx, "git", "range-diff", ranges[0], ranges[1])
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		return cmd.Run()
+	},
+}
+
+// applyOnWorktree applies a series on a temporary worktree at its declared base, returning the base and the
+// resulting commit -- the worktree is removed afterwards but the commits stay around for a while
+func applyOnWorktree(series []*nostr.Event) (base string, tip string, err error) {
+	base, err = git("rev-parse", getSeriesBase(series))
+	if err != nil {
+		return "", "", err
+	}
+
+	dir, err := os.MkdirTemp("", "gitstr-range-diff")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	worktree := filepath.Join(dir, "worktree")
+	if _, err := git("worktree", "add", "--detach", worktree, base); err != nil {
+		return "", "", err
+	}
+	defer git("worktree", "remove", "--force", worktree)
+
+	mbox := filepath.Join(dir, "series.mbox")
+	if err := os.WriteFile(mbox, seriesMailbox(series), 0644); err != nil {
+		return "", "", fmt.Errorf("failed to write '%s': %w", mbox, err)
+	}
+	if _, err := git("-C", worktree, "am", "--3way", mbox); err != nil {
+		git("-C", worktree, "am", "--abort")
+		return "", "", err
+	}
+
+	tip, err = git("-C", worktree, "rev-parse", "HEAD")
+	return base, tip, err
+}
@@ -0,0 +1,161 @@
+package gitstr
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// maxRelaysPerUser is how many relays we take from each user's relay list, so mentioning many people
+// doesn't mean publishing everywhere
+const maxRelaysPerUser = 3
+
+// relayList holds the relays someone declared on their NIP-65 kind 10002 event
+type relayList struct {
+	read  []string // where they expect to be mentioned
+	write []string // where they publish their own stuff
+}
+
+// fetchRelayLists gets the latest relay list of each of the given pubkeys, those without one are left out
+func fetchRelayLists(ctx context.Context, relays []string, pubkeys []string) map[string]relayList {
+	lists := make(map[string]relayList, len(pubkeys))
+	if len(pubkeys) == 0 {
+		return lists
+	}
+
+	latest := make(map[string]nostr.Timestamp, len(pubkeys))
+	for _, evt := range queryEvents(ctx, concatSlices(relays, profileRelays), nostr.Filter{
+		Kinds:   []int{nostr.KindRelayListMetadata},
+		Authors: pubkeys,
+	}) {
+		if evt.CreatedAt <= latest[evt.PubKey] {
+			continue
+		}
+		latest[evt.PubKey] = evt.CreatedAt
+
+		list := relayList{}
+		for _, tag := range evt.Tags.GetAll([]string{"r", ""}) {
+			url := nostr.NormalizeURL(tag[1])
+			if url == "" {
+				continue
+			}
+			// no marker means both
+			if len(tag) < 3 || tag[2] == "read" {
+				list.read = append(list.read, url)
+			}
+			if len(tag) < 3 || tag[2] == "write" {
+				list.write = append(list.write, url)
+			}
+		}
+		lists[evt.PubKey] = list
+	}
+
+	return lists
+}
+
+// getInboxRelays returns the read relays of the given pubkeys, where we should publish things addressed to them
+func getInboxRelays(ctx context.Context, relays []string, pubkeys []string) []string {
+	result := make([]string, 0, len(pubkeys)*maxRelaysPerUser)
+	for _, list := range fetchRelayLists(ctx, relays, uniqueValidKeys(pubkeys)) {
+		result = append(result, list.read[0:min(len(list.read), maxRelaysPerUser)]...)
+	}
+	slices.Sort(result)
+	return slices.Compact(result)
+}
+
+// getOutboxRelays returns the write relays of the given pubkeys, where we should look for things they published
+func getOutboxRelays(ctx context.Context, relays []string, pubkeys []string) []string {
+	result := make([]string, 0, len(pubkeys)*maxRelaysPerUser)
+	for _, list := range fetchRelayLists(ctx, relays, uniqueValidKeys(pubkeys)) {
+		result = append(result, list.write[0:min(len(list.write), maxRelaysPerUser)]...)
+	}
+	slices.Sort(result)
+	return slices.Compact(result)
+}
+
+func uniqueValidKeys(pubkeys []string) []string {
+	keys := filterSlice(slices.Clone(pubkeys), nostr.IsValidPublicKey)
+	slices.Sort(keys)
+	return slices.Compact(keys)
+}
+
+// uniqueRelays normalizes the given relay URLs and removes repeated ones, keeping their order
+func uniqueRelays(relays []string) []string {
+	seen := make(map[string]bool, len(relays))
+	result := make([]string, 0, len(relays))
+	for _, url := range relays {
+		url = nostr.NormalizeURL(url)
+		if url != "" && !seen[url] {
+			seen[url] = true
+			result = append(result, url)
+		}
+	}
+	return result
+}
+
+// isAuthRelay tells if we're allowed to authenticate to the given relay, as NIP-42 reveals who we are
+// it's only done for relays listed with `git config --add str.auth-relay <url>`
+func isAuthRelay(url string) bool {
+	allowed, _ := git("config", "--get-all", "str.auth-relay")
+	for _, line := range strings.Split(allowed, "\n") {
+		for _, allowedURL := range split(line) {
+			if nostr.NormalizeURL(allowedURL) == nostr.NormalizeURL(url) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// authHandler signs NIP-42 auth events for the relays that allow it, it's called by the pool whenever a
+// subscription is closed with "auth-required"
+func authHandler(ctx context.Context) func(*nostr.Event) error {
+	return func(authEvent *nostr.Event) error {
+		url := ""
+		if tag := authEvent.Tags.GetFirst([]string{"relay", ""}); tag != nil {
+			url = (*tag)[1]
+		}
+		if !isAuthRelay(url) {
+			logf(color.YellowString("%s requires authentication, allow it with `git config --add str.auth-relay %s`\n"), url, url)
+			return fmt.Errorf("authentication not allowed for %s", url)
+		}
+
+		if runningCommand == nil {
+			return fmt.Errorf("can't authenticate to %s outside of a command", url)
+		}
+		sign, err := gatherSigner(ctx, runningCommand)
+		if err != nil {
+			return err
+		}
+		logf("authenticating to %s\n", url)
+		return sign(authEvent)
+	}
+}
+
+// publishToRelay publishes the event, authenticating and trying again if the relay requires it
+func publishToRelay(ctx context.Context, relay *nostr.Relay, evt nostr.Event) error {
+	err := relay.Publish(ctx, evt)
+	if err == nil || !strings.Contains(err.Error(), "auth-required:") {
+		return err
+	}
+
+	if !isAuthRelay(relay.URL) {
+		return fmt.Errorf("%w (allow authentication with `git config --add str.auth-relay %s`)", err, relay.URL)
+	}
+	if runningCommand == nil {
+		return fmt.Errorf("%w (no key available to authenticate)", err)
+	}
+	sign, gerr := gatherSigner(ctx, runningCommand)
+	if gerr != nil {
+		return fmt.Errorf("%w (no key available to authenticate: %s)", err, gerr)
+	}
+	logf("authenticating...")
+	if err := relay.Auth(ctx, sign); err != nil {
+		return fmt.Errorf("failed to authenticate: %w", err)
+	}
+	return relay.Publish(ctx, evt)
+}
@@ -0,0 +1,153 @@
+package gitstr
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// RunRemoteHelper implements the git remote-helper protocol for nostr://naddr1... URLs: it finds the
+// repository announcement, picks the first clone URL that works and hands the transport over to it
+func RunRemoteHelper(ctx context.Context, remote string, address string) error {
+	naddr := strings.TrimPrefix(address, "nostr://")
+	prefix, data, err := nip19.Decode(naddr)
+	if err != nil || prefix != "naddr" {
+		return fmt.Errorf("invalid nostr remote '%s', expected nostr://naddr1...", address)
+	}
+	ep := data.(nostr.EntityPointer)
+	if ep.Kind != RepoAnnouncementKind {
+		return fmt.Errorf("invalid kind %d, expected %d", ep.Kind, RepoAnnouncementKind)
+	}
+
+	pool = nostr.NewSimplePool(ctx)
+	relays := concatSlices(ep.Relays, getPatchRelays())
+	if len(relays) == 0 {
+		return fmt.Errorf("%s has no relay hints, can't look for the repository announcement", naddr)
+	}
+	repo := fetchRepository(ctx, ep, relays)
+	if repo == nil {
+		return fmt.Errorf("couldn't find repository announcement for %s", naddr)
+	}
+
+	cloneURL := ""
+	for _, tag := range repo.Tags.GetAll([]string{"clone", ""}) {
+		for _, candidate := range tag[1:] {
+			logf("trying %s...", candidate)
+			if _, err := git("ls-remote", "--heads", candidate); err != nil {
+				logf(" failed\n")
+				continue
+			}
+			logf(" ok\n")
+			cloneURL = candidate
+			break
+		}
+		if cloneURL != "" {
+			break
+		}
+	}
+	if cloneURL == "" {
+		return fmt.Errorf("none of the clone URLs announced for %s work", naddr)
+	}
+
+	// tie this repository to the announcement so `git str` commands know where to send stuff
+	if upstream, _ := git("config", "--local", "str.upstream"); upstream == "" {
+		git("config", "--local", "str.upstream", naddr)
+	}
+
+	if u, err := url.Parse(cloneURL); err == nil && (u.Scheme == "http" || u.Scheme == "https" || u.Scheme == "ftp" || u.Scheme == "ftps") {
+		// git has its own helpers for these
+		cmd := exec.CommandContext(ctx, "git", "remote-"+u.Scheme, remote, cloneURL)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		return cmd.Run()
+	}
+
+	return serveConnect(ctx, cloneURL)
+}
+
+// serveConnect speaks the "connect" capability of the remote-helper protocol, spawning
+// git-upload-pack or git-receive-pack locally or through ssh depending on the URL
+func serveConnect(ctx context.Context, cloneURL string) error {
+	stdin := bufio.NewReader(os.Stdin)
+	for {
+		line, err := stdin.ReadString('\n')
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		command := strings.TrimSpace(line)
+		switch {
+		case command == "":
+			return nil
+		case command == "capabilities":
+			fmt.Fprint(os.Stdout, "connect\n\n")
+		case strings.HasPrefix(command, "connect "):
+			service := strings.TrimPrefix(command, "connect ")
+			args, err := transportCommand(cloneURL, service)
+			if err != nil {
+				return err
+			}
+			fmt.Fprint(os.Stdout, "\n")
+
+			cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+			cmd.Stdin = stdin
+			cmd.Stdout = os.Stdout
+			cmd.Stderr = os.Stderr
+			return cmd.Run()
+		default:
+			return fmt.Errorf("unsupported remote-helper command '%s'", command)
+		}
+	}
+}
+
+func transportCommand(cloneURL string, service string) ([]string, error) {
+	if u, err := url.Parse(cloneURL); err == nil && u.Scheme != "" {
+		switch u.Scheme {
+		case "ssh", "git+ssh", "ssh+git":
+			args := []string{"ssh"}
+			if u.Port() != "" {
+				args = append(args, "-p", u.Port())
+			}
+			host := u.Hostname()
+			if u.User != nil {
+				host = u.User.Username() + "@" + host
+			}
+			if strings.HasPrefix(host, "-") {
+				return nil, fmt.Errorf("invalid ssh host '%s'", host)
+			}
+			return append(args, host, service+" "+shellQuote(u.Path)), nil
+		case "file":
+			return []string{service, u.Path}, nil
+		default:
+			return nil, fmt.Errorf("unsupported clone URL scheme '%s'", u.Scheme)
+		}
+	}
+
+	// scp-like syntax, user@host:path
+	if host, path, ok := strings.Cut(cloneURL, ":"); ok && !strings.Contains(host, "/") {
+		if strings.HasPrefix(host, "-") {
+			return nil, fmt.Errorf("invalid ssh host '%s'", host)
+		}
+		return []string{"ssh", host, service + " " + shellQuote(path)}, nil
+	}
+
+	// a local path
+	return []string{service, cloneURL}, nil
+}
+
+// shellQuote makes the path a single argument for the remote shell ssh runs the command with, clone URLs
+// come from announcements so they can't be trusted
+func shellQuote(path string) string {
+	return "'" + strings.ReplaceAll(path, "'", `'\''`) + "'"
+}
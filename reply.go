@@ -0,0 +1,181 @@
+package gitstr
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip10"
+	"github.com/nbd-wtf/go-nostr/nip19"
+	"github.com/urfave/cli/v3"
+)
+
+var reply = &cli.Command{
+	Name:        "reply",
+	Usage:       "comment on a patch, an issue or another reply",
+	UsageText:   "git str reply <nevent>",
+	Description: "",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "sec",
+			Usage:   "secret key to sign the reply, as hex or nsec, or bunker:// URL, or a NIP-46-powered name@domain",
+			Aliases: []string{"connect"},
+		},
+		&cli.StringFlag{
+			Name:    "message",
+			Aliases: []string{"m"},
+			Usage:   "reply text, if not given an editor will be opened",
+		},
+		&cli.StringSliceFlag{
+			Name:    "relay",
+			Aliases: []string{"r"},
+			Usage:   "extra relays to search for the thread in and to publish the reply to",
+		},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		ep, err := parseEventPointer(c.Args().First())
+		if err != nil {
+			return err
+		}
+
+		relays := concatSlices(ep.Relays, getPatchRelays(), c.StringSlice("relay"))
+		ie := querySingle(ctx, relays, nostr.Filter{IDs: []string{ep.ID}})
+		if ie == nil {
+			return fmt.Errorf("couldn't find event %s", ep.ID)
+		}
+		if ie.Kind != PatchKind && ie.Kind != IssueKind && ie.Kind != ReplyKind {
+			return fmt.Errorf("event %s is not a patch, issue or reply (kind %d)", ie.ID, ie.Kind)
+		}
+
+		evt, relays := newReply(ctx, ie, relays)
+
+		// write the reply
+		evt.Content = c.String("message")
+		if evt.Content == "" && !interactive() {
+			return fmt.Errorf("no reply text, give it with --message")
+		}
+		if evt.Content == "" {
+			quoted := "> " + strings.ReplaceAll(strings.TrimSpace(ie.Content), "\n", "\n> ")
+			text, err := edit(quoted + "\n\n")
+			if err != nil {
+				return fmt.Errorf("error writing reply: %w", err)
+			}
+			evt.Content = strings.TrimSpace(text)
+			if evt.Content == "" || evt.Content == quoted {
+				return fmt.Errorf("reply is empty, aborting")
+			}
+		}
+
+		sign, err := gatherSigner(ctx, c)
+		if err != nil {
+			return err
+		}
+		if err := sign(evt); err != nil {
+			return err
+		}
+
+		logf("\n%s\n\n", evt.Content)
+		if ok, err := confirm("proceed to publish the event? "); err != nil {
+			return err
+		} else if !ok {
+			return nil
+		}
+
+		goodRelays := publish(ctx, *evt, relays)
+		code, _ := nip19.EncodeEvent(evt.ID, goodRelays, evt.PubKey)
+		printPublished(*evt, code, goodRelays, relays)
+		if len(goodRelays) == 0 {
+			return fmt.Errorf("didn't publish the event")
+		}
+		return nil
+	},
+}
+
+// newReply prepares a reply to the given patch, issue or reply with all the thread markers, the repository
+// and everybody involved, returning it along with the relays it should be published to
+func newReply(ctx context.Context, ie *foundEvent, relays []string) (*nostr.Event, []string) {
+	target := ie.Event
+
+	evt := &nostr.Event{
+		CreatedAt: nostr.Now(),
+		Kind:      ReplyKind,
+		Tags: nostr.Tags{
+			nostr.Tag{"alt", "a reply to a git patch or issue"},
+		},
+	}
+
+	// thread markers
+	rootID := getThreadRootID(target)
+	evt.Tags = append(evt.Tags, nostr.Tag{"e", rootID, ie.Relay, "root"})
+	if rootID != target.ID {
+		evt.Tags = append(evt.Tags, nostr.Tag{"e", target.ID, ie.Relay, "reply"})
+	}
+
+	// repository
+	if aTag := target.Tags.GetFirst([]string{"a", fmt.Sprintf("%d:", RepoAnnouncementKind)}); aTag != nil {
+		evt.Tags = append(evt.Tags, *aTag)
+	}
+	if rep, ok := getEventRepositoryPointer(target); ok {
+		if repo := fetchRepository(ctx, rep, relays); repo != nil {
+			relays = append(relays, getRepositoryRelays(repo.Event)...)
+		}
+	}
+
+	// everybody in the thread
+	mentions := []string{target.PubKey}
+	for _, tag := range target.Tags.GetAll([]string{"p", ""}) {
+		mentions = append(mentions, tag[1])
+	}
+	for _, te := range fetchThread(ctx, relays, rootID) {
+		mentions = append(mentions, te.PubKey)
+	}
+	slices.Sort(mentions)
+	for _, pk := range slices.Compact(mentions) {
+		if nostr.IsValidPublicKey(pk) {
+			evt.Tags = append(evt.Tags, nostr.Tag{"p", pk})
+		}
+	}
+
+	// so everybody gets it
+	relays = uniqueRelays(append(relays, getInboxRelays(ctx, relays, mentions)...))
+
+	return evt, relays
+}
+
+// getThreadRootID returns the id of the patch or issue that started the discussion the given event is part of
+func getThreadRootID(evt *nostr.Event) string {
+	if evt.Kind == IssueKind {
+		return evt.ID
+	}
+	if evt.Kind == PatchKind && (evt.Tags.GetFirst([]string{"t", "root"}) != nil ||
+		evt.Tags.GetFirst([]string{"t", "revision-root"}) != nil) {
+		return evt.ID
+	}
+	if tag := nip10.GetThreadRoot(evt.Tags); tag != nil {
+		return (*tag)[1]
+	}
+	return evt.ID
+}
+
+// fetchThread returns all the patches and replies that reference the given root
+func fetchThread(ctx context.Context, relays []string, rootID string) []*nostr.Event {
+	events := queryEvents(ctx, relays, nostr.Filter{
+		Kinds: []int{PatchKind, ReplyKind},
+		Tags:  nostr.TagMap{"e": []string{rootID}},
+	})
+	slices.SortFunc(events, func(a, b *nostr.Event) int { return int(a.CreatedAt - b.CreatedAt) })
+	return events
+}
+
+// getRevisedRootID returns, for the first patch of a revision, the id of the original series root it revises
+func getRevisedRootID(evt *nostr.Event) string {
+	if evt.Kind != PatchKind || evt.Tags.GetFirst([]string{"t", "revision-root"}) == nil {
+		return ""
+	}
+	if tag := nip10.GetImmediateReply(evt.Tags); tag != nil {
+		return (*tag)[1]
+	}
+	return ""
+}
@@ -0,0 +1,535 @@
+package gitstr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+	"github.com/urfave/cli/v3"
+)
+
+var repoCmd = &cli.Command{
+	Name:        "repo",
+	Usage:       "display a repository announcement",
+	UsageText:   "git str repo [naddr]",
+	Description: "if no naddr is given the upstream repository (the one patches are sent to) is used",
+	Commands: []*cli.Command{
+		repoEdit,
+	},
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:       "relay",
+			Aliases:    []string{"r"},
+			Usage:      "extra relays to search for the repository announcement in",
+			Persistent: true,
+		},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		var ep nostr.EntityPointer
+		if arg := c.Args().First(); arg != "" {
+			_, data, _ := nip19.Decode(arg)
+			var ok bool
+			ep, ok = data.(nostr.EntityPointer)
+			if !ok || ep.Kind != RepoAnnouncementKind {
+				return fmt.Errorf("invalid argument '%s', expected an naddr pointing to a repository", arg)
+			}
+		} else {
+			var err error
+			ep, err = getRepositoryPointer(c)
+			if err != nil {
+				return err
+			}
+		}
+
+		ie := fetchRepository(ctx, ep, c.StringSlice("relay"))
+		if ie == nil {
+			return fmt.Errorf("couldn't find repository announcement for '%s'", ep.Identifier)
+		}
+
+		naddr, _ := nip19.EncodeEntity(ie.PubKey, ie.Kind, ep.Identifier, uniqueRelays([]string{ie.Relay}))
+		if jsonOutput {
+			info := newRepositoryInfo(ie.Event)
+			info.Naddr = naddr
+			printJSON(info)
+			return nil
+		}
+		fmt.Println(naddr)
+		fmt.Print(sprintRepository(ie.Event))
+		return nil
+	},
+}
+
+// announcementFlags maps the flags shared by `init` and `repo edit` to the announcement tags they set, and
+// also to the "str.<flag>" git config entries where they are stored
+var announcementFlags = []struct {
+	flag  string
+	tag   string
+	multi bool
+}{
+	{"name", "name", false},
+	{"description", "description", false},
+	{"patches-relay", "relays", true},
+	{"clone-url", "clone", true},
+	{"web-url", "web", true},
+}
+
+// isManagedTag tells if gitstr sets the announcement tag with this key itself, tags with other keys come
+// from other clients
+func isManagedTag(key string) bool {
+	if key == "d" || key == "r" || key == "maintainers" {
+		return true
+	}
+	for _, field := range announcementFlags {
+		if field.tag == key {
+			return true
+		}
+	}
+	return false
+}
+
+var repoEdit = &cli.Command{
+	Name:        "edit",
+	Usage:       "change your repository announcement",
+	UsageText:   "git str repo edit [--name <name>] [--description <text>] [--clone-url <url>...]",
+	Description: "the current announcement is fetched from relays and changed according to the flags given, or opened on your editor as JSON if none is given, tags gitstr doesn't know about are kept",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "sec",
+			Usage:   "secret key to sign the repository announcement, as hex or nsec, or bunker:// URL, or a NIP-46-powered name@domain",
+			Aliases: []string{"connect"},
+		},
+		&cli.StringFlag{
+			Name:  "name",
+			Usage: "repository name",
+		},
+		&cli.StringFlag{
+			Name:  "description",
+			Usage: "repository brief description",
+		},
+		&cli.StringFlag{
+			Name:  "patches-relay",
+			Usage: "relays that will be used to read patches",
+		},
+		&cli.StringFlag{
+			Name:  "clone-url",
+			Usage: "URLs through which this repository can cloned",
+		},
+		&cli.StringFlag{
+			Name:  "web-url",
+			Usage: "URLs through which this repository can be browsed on the web",
+		},
+		&cli.StringSliceFlag{
+			Name:  "maintainer",
+			Usage: "other people who maintain this repository, as npub, hex or name@domain, replacing the current list",
+		},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		id := getRepositoryID()
+		pk := getRepositoryPublicKey()
+		if id == "" || pk == "" {
+			return fmt.Errorf("no repository announcement found on `git config`, call `git str init` first")
+		}
+
+		relays := concatSlices(c.StringSlice("relay"), getPatchRelays(), announcementRelays)
+		found := latestAnnouncements(queryEvents(ctx, relays, nostr.Filter{
+			Kinds:   []int{RepoAnnouncementKind},
+			Authors: []string{pk},
+			Tags:    nostr.TagMap{"d": []string{id}},
+		}))
+		if len(found) == 0 {
+			return fmt.Errorf("couldn't find the announcement for '%s' on %v, call `git str init` to publish it again", id, relays)
+		}
+		current := found[0]
+
+		// repositories initialized by older versions don't have this set
+		announcedAt, _ := git("config", "--local", "str.announced-at")
+		if ts, err := strconv.ParseInt(announcedAt, 10, 64); err == nil && current.CreatedAt > nostr.Timestamp(ts) {
+			logf(color.YellowString("the announcement on relays (%s) is newer than the last one published from here, editing that one and updating `git config` with it\n"),
+				humanDate(current.CreatedAt))
+		}
+
+		evt := nostr.Event{
+			CreatedAt: max(nostr.Now(), current.CreatedAt+1),
+			Kind:      RepoAnnouncementKind,
+			Content:   current.Content,
+			Tags:      append(nostr.Tags{}, current.Tags...),
+		}
+
+		changed := false
+		for _, field := range announcementFlags {
+			if !c.IsSet(field.flag) {
+				continue
+			}
+			tag := nostr.Tag{field.tag}
+			if field.multi {
+				tag = append(tag, split(c.String(field.flag))...)
+			} else {
+				tag = append(tag, c.String(field.flag))
+			}
+			evt.Tags = setTag(evt.Tags, tag)
+			changed = true
+		}
+		if c.IsSet("maintainer") {
+			tag := nostr.Tag{"maintainers"}
+			for _, maintainer := range c.StringSlice("maintainer") {
+				pk, err := parsePublicKey(ctx, maintainer)
+				if err != nil {
+					return err
+				}
+				tag = append(tag, pk)
+			}
+			evt.Tags = setTag(evt.Tags, tag)
+			changed = true
+		}
+
+		if !changed && !interactive() {
+			return fmt.Errorf("nothing to change, use --name, --description, --patches-relay, --clone-url, --web-url or --maintainer")
+		}
+		if !changed {
+			lines := make([]string, len(evt.Tags))
+			for i, tag := range evt.Tags {
+				j, _ := json.Marshal(tag)
+				lines[i] = string(j)
+			}
+			text, err := edit("[\n  " + strings.Join(lines, ",\n  ") + "\n]\n")
+			if err != nil {
+				return fmt.Errorf("error editing announcement: %w", err)
+			}
+			var tags nostr.Tags
+			if err := json.Unmarshal([]byte(text), &tags); err != nil {
+				return fmt.Errorf("invalid tags: %w", err)
+			}
+			evt.Tags = tags
+		}
+
+		if tag := evt.Tags.GetFirst([]string{"d", ""}); tag == nil || (*tag)[1] != id {
+			return fmt.Errorf("the 'd' tag can't be changed, it must stay as '%s'", id)
+		}
+
+		sign, err := gatherSigner(ctx, c)
+		if err != nil {
+			return err
+		}
+		if err := sign(&evt); err != nil {
+			return err
+		}
+		if evt.PubKey != pk {
+			npub, _ := nip19.EncodePublicKey(pk)
+			return fmt.Errorf("this announcement belongs to %s, sign it with that key", npub)
+		}
+
+		logf("%s\n", sprintRepository(&evt))
+		if ok, err := confirm("publish the updated announcement? "); err != nil {
+			return err
+		} else if !ok {
+			return nil
+		}
+
+		targets := uniqueRelays(concatSlices(c.StringSlice("relay"), getRepositoryRelays(current), getRepositoryRelays(&evt)))
+		successRelays := publish(ctx, evt, targets)
+		naddr, _ := nip19.EncodeEntity(evt.PubKey, RepoAnnouncementKind, id, successRelays)
+		printPublished(evt, naddr, successRelays, targets)
+		if len(successRelays) == 0 {
+			return fmt.Errorf("couldn't publish the event to any relays, use -r or --relay to specify some relays")
+		}
+
+		// keep `git config` in sync with what was published
+		for _, field := range announcementFlags {
+			if tag := evt.Tags.GetFirst([]string{field.tag, ""}); tag != nil {
+				git("config", "--local", "str."+field.flag, strings.Join((*tag)[1:], " "))
+			}
+		}
+		git("config", "--local", "str.maintainers", strings.Join(getRepositoryMaintainers(&evt), " "))
+		git("config", "--local", "str.announced-at", strconv.FormatInt(int64(evt.CreatedAt), 10))
+		return nil
+	},
+}
+
+// setTag replaces all the tags with the same key as the given one by it, at the position of the first, or
+// appends it
+func setTag(tags nostr.Tags, tag nostr.Tag) nostr.Tags {
+	result := make(nostr.Tags, 0, len(tags)+1)
+	replaced := false
+	for _, existing := range tags {
+		if len(existing) == 0 || existing[0] != tag[0] {
+			result = append(result, existing)
+		} else if !replaced {
+			result = append(result, tag)
+			replaced = true
+		}
+	}
+	if !replaced {
+		result = append(result, tag)
+	}
+	return result
+}
+
+var reposCmd = &cli.Command{
+	Name:        "repos",
+	Usage:       "search for repository announcements",
+	UsageText:   "git str repos [--author <npub>] [--name <text>] [--tag <hashtag>] [--local]",
+	Description: "prints the naddr of each repository found, which can be given to `git str send --to`",
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:    "relay",
+			Aliases: []string{"r"},
+			Usage:   "extra relays to search for announcements in",
+		},
+		&cli.StringSliceFlag{
+			Name:    "author",
+			Aliases: []string{"a"},
+			Usage:   "only show repositories announced by these keys, as npub, hex or name@domain",
+		},
+		&cli.StringFlag{
+			Name:    "name",
+			Aliases: []string{"n"},
+			Usage:   "only show repositories with this text in their name or id",
+		},
+		&cli.StringSliceFlag{
+			Name:    "tag",
+			Aliases: []string{"t"},
+			Usage:   "only show repositories labeled with these hashtags",
+		},
+		&cli.StringFlag{
+			Name:  "euc",
+			Usage: "only show repositories with this earliest unique commit",
+		},
+		&cli.BoolFlag{
+			Name:  "local",
+			Usage: "only show announcements of the repository we're in, by its earliest unique commit",
+		},
+		&cli.IntFlag{
+			Name:    "limit",
+			Aliases: []string{"l"},
+			Value:   100,
+			Usage:   "maximum number of announcements to fetch",
+		},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		filter := nostr.Filter{
+			Kinds: []int{RepoAnnouncementKind},
+			Tags:  nostr.TagMap{},
+			Limit: int(c.Int("limit")),
+		}
+		for _, author := range c.StringSlice("author") {
+			pk, err := parsePublicKey(ctx, author)
+			if err != nil {
+				return err
+			}
+			filter.Authors = append(filter.Authors, pk)
+		}
+		if tags := c.StringSlice("tag"); len(tags) > 0 {
+			filter.Tags["t"] = tags
+		}
+		euc := c.String("euc")
+		if c.Bool("local") {
+			euc = getEarliestUniqueCommit()
+			if euc == "" {
+				return fmt.Errorf("couldn't find the earliest unique commit of the current repository")
+			}
+		}
+		if euc != "" {
+			filter.Tags["r"] = []string{euc}
+		}
+
+		relays := concatSlices(announcementRelays, getPatchRelays(), c.StringSlice("relay"))
+		repos := latestAnnouncements(queryEvents(ctx, relays, filter))
+		if name := strings.ToLower(c.String("name")); name != "" {
+			repos = slices.DeleteFunc(repos, func(repo *nostr.Event) bool {
+				for _, tag := range repo.Tags {
+					if len(tag) >= 2 && (tag[0] == "d" || tag[0] == "name") &&
+						strings.Contains(strings.ToLower(tag[1]), name) {
+						return false
+					}
+				}
+				return true
+			})
+		}
+		if jsonOutput {
+			infos := make([]repositoryInfo, len(repos))
+			for i, repo := range repos {
+				infos[i] = newRepositoryInfo(repo)
+			}
+			printJSON(infos)
+			return nil
+		}
+		if len(repos) == 0 {
+			logf(color.YellowString("no repositories found\n"))
+			return nil
+		}
+
+		owners := make([]string, 0, len(repos))
+		for _, repo := range repos {
+			owners = append(owners, repo.PubKey)
+		}
+		slices.Sort(owners)
+		names := fetchDisplayNames(ctx, relays, slices.Compact(owners))
+
+		for _, repo := range repos {
+			fmt.Println(getRepositoryNaddr(repo))
+			name := getRepositoryName(repo)
+			if tag := repo.Tags.GetFirst([]string{"description", ""}); tag != nil && (*tag)[1] != "" {
+				name += color.New(color.Faint).Sprint(" - " + (*tag)[1])
+			}
+			fmt.Printf("  %s %s %s\n",
+				color.New(color.Bold).Sprint(name),
+				color.CyanString(names[repo.PubKey]),
+				color.New(color.Faint).Sprint(humanAgo(repo.CreatedAt)),
+			)
+		}
+		return nil
+	},
+}
+
+// repositoryInfo is how announcements are shown with --json
+type repositoryInfo struct {
+	Naddr                string       `json:"naddr"`
+	ID                   string       `json:"id"`
+	Name                 string       `json:"name"`
+	Description          string       `json:"description,omitempty"`
+	Owner                string       `json:"owner"`
+	Maintainers          []string     `json:"maintainers,omitempty"`
+	Clone                []string     `json:"clone,omitempty"`
+	Web                  []string     `json:"web,omitempty"`
+	Relays               []string     `json:"relays,omitempty"`
+	EarliestUniqueCommit string       `json:"earliest_unique_commit,omitempty"`
+	Event                *nostr.Event `json:"event"`
+}
+
+func newRepositoryInfo(repo *nostr.Event) repositoryInfo {
+	info := repositoryInfo{
+		Naddr:       getRepositoryNaddr(repo),
+		ID:          getRepositoryIdentifier(repo),
+		Name:        getRepositoryName(repo),
+		Owner:       repo.PubKey,
+		Maintainers: getRepositoryMaintainers(repo),
+		Relays:      getRepositoryRelays(repo),
+		Event:       repo,
+	}
+	if tag := repo.Tags.GetFirst([]string{"description", ""}); tag != nil {
+		info.Description = (*tag)[1]
+	}
+	for _, tag := range repo.Tags.GetAll([]string{"clone", ""}) {
+		info.Clone = append(info.Clone, tag[1:]...)
+	}
+	for _, tag := range repo.Tags.GetAll([]string{"web", ""}) {
+		info.Web = append(info.Web, tag[1:]...)
+	}
+	if tag := repo.Tags.GetFirst([]string{"r", ""}); tag != nil {
+		info.EarliestUniqueCommit = (*tag)[1]
+	}
+	return info
+}
+
+// latestAnnouncements keeps only the newest version of each repository announcement, newest first
+func latestAnnouncements(events []*nostr.Event) []*nostr.Event {
+	latest := make(map[string]*nostr.Event, len(events))
+	result := make([]*nostr.Event, 0, len(events))
+	for _, evt := range events {
+		key := evt.PubKey + ":" + getRepositoryIdentifier(evt)
+		if curr, ok := latest[key]; !ok || curr.CreatedAt < evt.CreatedAt {
+			latest[key] = evt
+		}
+	}
+	for _, evt := range latest {
+		result = append(result, evt)
+	}
+	slices.SortFunc(result, func(a, b *nostr.Event) int { return int(b.CreatedAt - a.CreatedAt) })
+	return result
+}
+
+func getRepositoryIdentifier(repo *nostr.Event) string {
+	if tag := repo.Tags.GetFirst([]string{"d", ""}); tag != nil {
+		return (*tag)[1]
+	}
+	return ""
+}
+
+// getRepositoryName returns the name given in the announcement, falling back to its id
+func getRepositoryName(repo *nostr.Event) string {
+	if tag := repo.Tags.GetFirst([]string{"name", ""}); tag != nil && (*tag)[1] != "" {
+		return (*tag)[1]
+	}
+	return getRepositoryIdentifier(repo)
+}
+
+// getRepositoryNaddr encodes a pointer to the announcement with a few of the relays it declares
+func getRepositoryNaddr(repo *nostr.Event) string {
+	relays := getRepositoryRelays(repo)
+	if len(relays) > 3 {
+		relays = relays[0:3]
+	}
+	naddr, _ := nip19.EncodeEntity(repo.PubKey, RepoAnnouncementKind, getRepositoryIdentifier(repo), relays)
+	return naddr
+}
+
+// fetchMaintainerRepositories starts at the given announcement and follows its "maintainers" tag to the
+// announcements with the same identifier published by each maintainer, and theirs, and so on
+func fetchMaintainerRepositories(ctx context.Context, ep nostr.EntityPointer, extraRelays []string) []*nostr.Event {
+	relays := concatSlices(ep.Relays, extraRelays)
+	visited := map[string]bool{ep.PublicKey: true}
+	pending := []string{ep.PublicKey}
+	repos := make([]*nostr.Event, 0, 3)
+
+	for len(pending) > 0 {
+		found := latestAnnouncements(queryEvents(ctx, relays, nostr.Filter{
+			Kinds:   []int{RepoAnnouncementKind},
+			Authors: pending,
+			Tags:    nostr.TagMap{"d": []string{ep.Identifier}},
+		}))
+		pending = nil
+		for _, repo := range found {
+			repos = append(repos, repo)
+			relays = append(relays, getRepositoryRelays(repo)...)
+			for _, pk := range getRepositoryMaintainers(repo) {
+				if !visited[pk] {
+					visited[pk] = true
+					pending = append(pending, pk)
+				}
+			}
+		}
+	}
+
+	// the one we started from goes first
+	slices.SortStableFunc(repos, func(a, b *nostr.Event) int {
+		if a.PubKey == ep.PublicKey {
+			return -1
+		} else if b.PubKey == ep.PublicKey {
+			return 1
+		}
+		return 0
+	})
+	return repos
+}
+
+// getRepositoryMaintainers returns the valid public keys in the "maintainers" tag of an announcement
+func getRepositoryMaintainers(repo *nostr.Event) []string {
+	maintainers := make([]string, 0, 3)
+	for _, tag := range repo.Tags.GetAll([]string{"maintainers", ""}) {
+		for _, pk := range tag[1:] {
+			if nostr.IsValidPublicKey(pk) {
+				maintainers = append(maintainers, pk)
+			}
+		}
+	}
+	return maintainers
+}
+
+// getRepositoryAddresses returns the values patches use in their "a" tags to point to each of the given
+// announcements, or to ep if none were found
+func getRepositoryAddresses(ep nostr.EntityPointer, repos []*nostr.Event) []string {
+	if len(repos) == 0 {
+		return []string{fmt.Sprintf("%d:%s:%s", RepoAnnouncementKind, ep.PublicKey, ep.Identifier)}
+	}
+	addresses := make([]string, len(repos))
+	for i, repo := range repos {
+		addresses[i] = fmt.Sprintf("%d:%s:%s", RepoAnnouncementKind, repo.PubKey, getRepositoryIdentifier(repo))
+	}
+	return addresses
+}
@@ -0,0 +1,212 @@
+package gitstr
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+	"github.com/urfave/cli/v3"
+)
+
+var hunkHeaderRegex = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,\d+)? @@`)
+
+var review = &cli.Command{
+	Name:        "review",
+	Usage:       "comment on specific lines of a patch",
+	UsageText:   "git str review <nevent>",
+	Description: "the patch is opened on your editor with all lines quoted, write your comments below the lines they refer to and each of them will be published as a separate reply",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "sec",
+			Usage:   "secret key to sign the review, as hex or nsec, or bunker:// URL, or a NIP-46-powered name@domain",
+			Aliases: []string{"connect"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "relay",
+			Aliases: []string{"r"},
+			Usage:   "extra relays to search for the patch in and to publish the review to",
+		},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		ep, err := parseEventPointer(c.Args().First())
+		if err != nil {
+			return err
+		}
+
+		relays := concatSlices(ep.Relays, getPatchRelays(), c.StringSlice("relay"))
+		ie := querySingle(ctx, relays, nostr.Filter{IDs: []string{ep.ID}})
+		if ie == nil {
+			return fmt.Errorf("couldn't find patch %s", ep.ID)
+		}
+		if ie.Kind != PatchKind {
+			return fmt.Errorf("event %s is not a patch (kind %d)", ie.ID, ie.Kind)
+		}
+
+		if !interactive() {
+			return fmt.Errorf("reviews are written on an editor, in non-interactive mode use `git str reply --message` instead")
+		}
+		quoted := "> " + strings.ReplaceAll(strings.TrimSpace(ie.Content), "\n", "\n> ")
+		text, err := edit(quoted + "\n")
+		if err != nil {
+			return fmt.Errorf("error writing review: %w", err)
+		}
+		comments := parseReview(text)
+		if len(comments) == 0 {
+			return fmt.Errorf("no comments written, aborting")
+		}
+
+		template, relays := newReply(ctx, ie, relays)
+		sign, err := gatherSigner(ctx, c)
+		if err != nil {
+			return err
+		}
+
+		events := make([]*nostr.Event, len(comments))
+		for i, comment := range comments {
+			evt := &nostr.Event{
+				CreatedAt: nostr.Now(),
+				Kind:      ReplyKind,
+				Tags:      append(nostr.Tags{}, template.Tags...),
+				Content:   comment.text,
+			}
+			if comment.file != "" {
+				evt.Tags = append(evt.Tags,
+					nostr.Tag{"file", comment.file},
+					nostr.Tag{"lines", strconv.Itoa(comment.start), strconv.Itoa(comment.end)},
+				)
+				evt.Content = comment.quote + "\n\n" + comment.text
+			}
+			if err := sign(evt); err != nil {
+				return err
+			}
+			events[i] = evt
+
+			logf("\n%s\n%s\n", color.New(color.Bold).Sprint(comment.location()), evt.Content)
+		}
+
+		if ok, err := confirm(fmt.Sprintf("proceed to publish %d comments? ", len(events))); err != nil {
+			return err
+		} else if !ok {
+			return nil
+		}
+		results := make([]publishedEvent, 0, len(events))
+		for _, evt := range events {
+			goodRelays := publish(ctx, *evt, relays)
+			if len(goodRelays) == 0 {
+				logf(color.RedString("didn't publish the event\n"))
+			}
+			code, _ := nip19.EncodeEvent(evt.ID, goodRelays, evt.PubKey)
+			if jsonOutput {
+				results = append(results, newPublishedEvent(*evt, code, goodRelays, relays))
+			} else {
+				printPublished(*evt, code, goodRelays, relays)
+			}
+		}
+		if jsonOutput {
+			printJSON(results)
+		}
+		return nil
+	},
+}
+
+type reviewComment struct {
+	file  string
+	start int
+	end   int
+	quote string
+	text  string
+}
+
+func (rc reviewComment) location() string {
+	if rc.file == "" {
+		return "general comment"
+	}
+	if rc.start == rc.end {
+		return fmt.Sprintf("%s:%d", rc.file, rc.start)
+	}
+	return fmt.Sprintf("%s:%d-%d", rc.file, rc.start, rc.end)
+}
+
+// patchWalker keeps track of the file and line of the new version we're at while reading a patch
+type patchWalker struct {
+	file   string
+	inHunk bool
+	line   int // number of the last line of the new version we've seen
+}
+
+func (pw *patchWalker) next(line string) {
+	switch {
+	case strings.HasPrefix(line, "diff --git "):
+		pw.inHunk = false
+		if _, b, ok := strings.Cut(line, " b/"); ok {
+			pw.file = b
+		}
+	case !pw.inHunk && strings.HasPrefix(line, "+++ b/"):
+		pw.file = strings.TrimPrefix(line, "+++ b/")
+	case hunkHeaderRegex.MatchString(line):
+		pw.inHunk = true
+		start, _ := strconv.Atoi(hunkHeaderRegex.FindStringSubmatch(line)[1])
+		pw.line = start - 1
+	case pw.inHunk && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "+") || line == ""):
+		pw.line++
+	}
+}
+
+// parseReview reads the text written on the editor: quoted lines are the patch, everything else is a comment
+// on the lines quoted right above it
+func parseReview(text string) []reviewComment {
+	comments := make([]reviewComment, 0, 5)
+	pw := &patchWalker{}
+	rangeStart := 0
+	quote := make([]string, 0, 10)
+	pending := make([]string, 0, 5)
+
+	flush := func() {
+		body := strings.TrimSpace(strings.Join(pending, "\n"))
+		pending = pending[:0]
+		if body == "" {
+			return
+		}
+		comment := reviewComment{text: body}
+		// right after a hunk header there's no line to attach it to, so it's a general comment
+		if pw.inHunk && pw.file != "" && len(quote) > 0 {
+			comment.file = pw.file
+			comment.start = min(rangeStart, pw.line)
+			comment.end = pw.line
+			if len(quote) > 5 {
+				quote = quote[len(quote)-5:]
+			}
+			comment.quote = "> " + strings.Join(quote, "\n> ")
+		}
+		comments = append(comments, comment)
+		quote = quote[:0]
+		rangeStart = pw.line + 1
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		if !strings.HasPrefix(line, ">") {
+			pending = append(pending, line)
+			continue
+		}
+		flush()
+
+		original := strings.TrimPrefix(strings.TrimPrefix(line, ">"), " ")
+		wasInHunk, previousFile := pw.inHunk, pw.file
+		pw.next(original)
+		if pw.inHunk && (!wasInHunk || pw.file != previousFile || hunkHeaderRegex.MatchString(original)) {
+			rangeStart = pw.line + 1
+			quote = quote[:0]
+		}
+		if pw.inHunk && !hunkHeaderRegex.MatchString(original) {
+			quote = append(quote, original)
+		}
+	}
+	flush()
+
+	return comments
+}
@@ -0,0 +1,138 @@
+package gitstr
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const testPatch = `From 1234 Mon Sep 17 00:00:00 2001
+Subject: [PATCH] change things
+
+diff --git a/a.txt b/a.txt
+index 1111111..2222222 100644
+--- a/a.txt
++++ b/a.txt
+@@ -1,4 +1,3 @@
+ one
+-two
+-three
++new
+ four
+diff --git a/b.txt b/b.txt
+new file mode 100644
+--- /dev/null
++++ b/b.txt
+@@ -0,0 +1,2 @@
++first
++second`
+
+func quote(text string) string {
+	return "> " + strings.ReplaceAll(text, "\n", "\n> ")
+}
+
+func TestParseReview(t *testing.T) {
+	lines := strings.Split(quote(testPatch), "\n")
+	// inserts comments after the given quoted lines of the patch
+	review := func(comments map[int]string) string {
+		res := make([]string, 0, len(lines)+len(comments))
+		for i, line := range lines {
+			res = append(res, line)
+			if comment, ok := comments[i]; ok {
+				res = append(res, comment)
+			}
+		}
+		return strings.Join(res, "\n")
+	}
+
+	for _, test := range []struct {
+		name     string
+		text     string
+		expected []reviewComment
+	}{
+		{"no comments", review(nil), []reviewComment{}},
+		{"context line", review(map[int]string{8: "about one"}), []reviewComment{
+			{file: "a.txt", start: 1, end: 1, quote: ">  one", text: "about one"},
+		}},
+		{"removed lines stay on the previous line", review(map[int]string{10: "about two and three"}), []reviewComment{
+			{file: "a.txt", start: 1, end: 1, quote: ">  one\n> -two\n> -three", text: "about two and three"},
+		}},
+		{"range since the previous comment", review(map[int]string{8: "a", 12: "b"}), []reviewComment{
+			{file: "a.txt", start: 1, end: 1, quote: ">  one", text: "a"},
+			{file: "a.txt", start: 2, end: 3, quote: "> -two\n> -three\n> +new\n>  four", text: "b"},
+		}},
+		{"new file", review(map[int]string{19: "about second"}), []reviewComment{
+			{file: "b.txt", start: 1, end: 2, quote: "> +first\n> +second", text: "about second"},
+		}},
+		{"after a hunk header", review(map[int]string{17: "about the file"}), []reviewComment{
+			{text: "about the file"},
+		}},
+		{"before the diff", review(map[int]string{1: "about the subject"}), []reviewComment{
+			{text: "about the subject"},
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			comments := parseReview(test.text)
+			if len(comments) != len(test.expected) {
+				t.Fatalf("expected %d comments, got %d: %v", len(test.expected), len(comments), comments)
+			}
+			for i, comment := range comments {
+				if comment != test.expected[i] {
+					t.Errorf("comment %d: expected %#v, got %#v", i, test.expected[i], comment)
+				}
+			}
+		})
+	}
+}
+
+func TestSprintDiff(t *testing.T) {
+	color.NoColor = true
+
+	comment := func(file string, start string, end string, text string) *nostr.Event {
+		evt := &nostr.Event{Kind: ReplyKind, Content: text}
+		if file != "" {
+			evt.Tags = nostr.Tags{{"file", file}, {"lines", start, end}}
+		}
+		return evt
+	}
+
+	for _, test := range []struct {
+		name     string
+		comments []*nostr.Event
+		after    map[string]string // comment text => line it must come right after
+	}{
+		{"context line followed by removed lines", []*nostr.Event{comment("a.txt", "1", "1", "on one")},
+			map[string]string{"on one": " one"}},
+		{"added line", []*nostr.Event{comment("a.txt", "2", "2", "on new")},
+			map[string]string{"on new": "+new"}},
+		{"new file", []*nostr.Event{comment("b.txt", "1", "2", "on second")},
+			map[string]string{"on second": "+second"}},
+		{"general", []*nostr.Event{comment("", "", "", "in general")},
+			map[string]string{"in general": "+second"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			lines := strings.Split(sprintDiff(testPatch, map[string]string{"": "someone"}, test.comments), "\n")
+			for text, after := range test.after {
+				found := 0
+				for i, line := range lines {
+					if line != "    │ "+text {
+						continue
+					}
+					found++
+					previous := ""
+					if i >= 2 {
+						previous = lines[i-2]
+					}
+					if previous != after {
+						t.Errorf("expected '%s' after '%s', got it after '%s'", text, after, previous)
+					}
+				}
+				if found != 1 {
+					t.Errorf("expected '%s' once, found it %d times", text, found)
+				}
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/fatih/color"
@@ -45,18 +46,31 @@ var send = &cli.Command{
 			Aliases: []string{"e"},
 			Usage:   "reply to another git event, as an nevent1... or hex code",
 		},
+		&cli.StringFlag{
+			Name:  "revise",
+			Usage: "send these patches as a new revision of a previous patch series, as an nevent1... or hex code",
+		},
 		&cli.StringSliceFlag{
 			Name:    "relay",
 			Aliases: []string{"r"},
 			Usage:   "extra relays to search for the target repository in and to publish the patch to",
 		},
-		&cli.BoolFlag{
-			Name:    "yes",
-			Aliases: []string{"y"},
-			Usage:   "do not ask for confirmation before publishing",
-		},
 	}, gitFormatPatchFlags...),
 	Action: func(ctx context.Context, c *cli.Command) error {
+		// the series we're revising, if any
+		var revised *foundEvent
+		if target := c.String("revise"); target != "" {
+			if c.String("in-reply-to") != "" {
+				return fmt.Errorf("--revise and --in-reply-to can't be used together")
+			}
+			var err error
+			revised, err = fetchRevisedRoot(ctx, target, c.StringSlice("relay"))
+			if err != nil {
+				return err
+			}
+			logf("%s %s\n", color.YellowString("sending a new revision of"), getPatchSubject(revised.Event))
+		}
+
 		// git-format-patch extra flags that will be handled directly to it
 		gitFormatPatchArgs := []string{"format-patch", "--stdout"}
 		for _, fd := range gitFormatPatchFlags {
@@ -69,6 +83,19 @@ var send = &cli.Command{
 				}
 			}
 		}
+		if revised != nil && !c.IsSet("reroll-count") {
+			// the next version after the original and all the revisions already sent
+			version := getPatchVersion(revised.Event)
+			for _, revision := range fetchRevisions(ctx, concatSlices(getPatchRelays(), c.StringSlice("relay")), revised.Event) {
+				version = max(version, getPatchVersion(revision))
+			}
+			gitFormatPatchArgs = append(gitFormatPatchArgs, "--reroll-count="+strconv.Itoa(version+1))
+		}
+
+		// git-format-patch is called once for each argument, so it would make one cover letter for each
+		if c.Bool("cover-letter") && c.Args().Len() > 1 {
+			return fmt.Errorf("--cover-letter can only be used with a single commit or range")
+		}
 
 		// commit or file
 		patches := make([]string, 0, 10)
@@ -93,6 +120,8 @@ var send = &cli.Command{
 				for _, patch := range strings.Split(out, "\n\nFrom ") {
 					patches = append(patches, "From "+patch)
 				}
+			} else if c.Bool("cover-letter") {
+				return fmt.Errorf("--cover-letter can't be used with patch files, only with commits")
 			} else {
 				patches = append(patches, string(contents))
 			}
@@ -103,7 +132,22 @@ var send = &cli.Command{
 			return fmt.Errorf("couldn't get any patches for %v", c.Args().Slice())
 		}
 
-		// create the events
+		// the cover letter generated by git-format-patch must be filled in
+		if c.Bool("cover-letter") {
+			if !interactive() {
+				return fmt.Errorf("the cover letter must be filled on an editor, in non-interactive mode write it with `git format-patch --cover-letter` and send the files")
+			}
+			var err error
+			patches[0], err = edit(patches[0])
+			if err != nil {
+				return fmt.Errorf("error editing cover letter: %w", err)
+			}
+			if strings.Contains(patches[0], "*** SUBJECT HERE ***") {
+				return fmt.Errorf("cover letter subject wasn't filled, aborting")
+			}
+		}
+
+		// create the events -- the first one is the root of the series, the others will reference it
 		events := make([]*nostr.Event, len(patches))
 		for i := range patches {
 			events[i] = &nostr.Event{
@@ -111,17 +155,28 @@ var send = &cli.Command{
 				Kind:      PatchKind,
 				Tags: nostr.Tags{
 					nostr.Tag{"alt", "a git patch"},
-					nostr.Tag{"t", "root"},
 				},
 			}
 		}
+		if revised != nil {
+			events[0].Tags = append(events[0].Tags,
+				nostr.Tag{"t", "revision-root"},
+				nostr.Tag{"e", revised.ID, revised.Relay, "reply"},
+				nostr.Tag{"p", revised.PubKey},
+			)
+		} else {
+			events[0].Tags = append(events[0].Tags, nostr.Tag{"t", "root"})
+		}
+		if c.Bool("cover-letter") {
+			events[0].Tags = append(events[0].Tags, nostr.Tag{"t", "cover-letter"})
+		}
 
 		// get metadata and apply it to events
 		patchRelays, err := getAndApplyTargetRepository(ctx, c, events, c.StringSlice("relay"))
 		if err != nil {
 			return err
 		}
-		threadRelays, err := getAndApplyTargetThread(ctx, c, events)
+		threadRelays, err := getAndApplyTargetThread(ctx, c, events[0:1])
 		if err != nil {
 			return err
 		}
@@ -131,12 +186,15 @@ var send = &cli.Command{
 		}
 
 		// check if there are relays available
-		targetRelays := concatSlices(patchRelays, threadRelays, mentionRelays, c.StringSlice("relay"))
+		targetRelays := uniqueRelays(concatSlices(patchRelays, threadRelays, mentionRelays, c.StringSlice("relay")))
 		if len(targetRelays) == 0 {
 			return fmt.Errorf("got no relays to publish to, you can specify one with --relay/-r")
 		}
 
 		// possibly annotate and assign patch content to events
+		if c.Bool("annotate") && !interactive() {
+			return fmt.Errorf("--annotate opens an editor, it can't be used in non-interactive mode")
+		}
 		for i, patch := range patches {
 			if c.Bool("annotate") {
 				var err error
@@ -147,61 +205,60 @@ var send = &cli.Command{
 			} else {
 				events[i].Content = patch
 			}
+			events[i].Tags = append(events[i].Tags, getCommitTags(patch)...)
 		}
 
 		// gather the secret key
-		bunker, sec, isEncrypted, err := gatherSecretKeyOrBunker(ctx, c)
+		sign, err := gatherSigner(ctx, c)
 		if err != nil {
 			return err
 		}
-		if isEncrypted {
-			sec, err = promptDecrypt(sec)
-			if err != nil {
-				return err
-			}
-		}
 
 		// publish all the patches
-		for _, evt := range events {
-			if bunker != nil {
-				logf(color.YellowString("signing event with bunker..."))
-				err = bunker.SignEvent(ctx, evt)
-				if err != nil {
-					return fmt.Errorf("error signing event with bunker: %w", err)
-				}
-			} else {
-				err = evt.Sign(sec)
-				if err != nil {
-					return fmt.Errorf("error signing event with key: %w", err)
+		results := make([]publishedEvent, 0, len(events))
+		var previous *nostr.Event // the last one published, patches that were declined are skipped over
+		for i, evt := range events {
+			if i > 0 {
+				evt.Tags = append(evt.Tags, nostr.Tag{"e", events[0].ID, targetRelays[0], "root"})
+				if previous != events[0] {
+					evt.Tags = append(evt.Tags, nostr.Tag{"e", previous.ID, targetRelays[0], "reply"})
 				}
 			}
+			if err := sign(evt); err != nil {
+				return err
+			}
 
-			goodRelays := make([]string, 0, len(targetRelays))
 			logf("\n%s", sprintPatch(evt))
-			if confirm("proceed to publish the event? ") {
-				for _, r := range targetRelays {
-					relay, err := pool.EnsureRelay(r)
-					if err != nil {
-						logf("failed to connect to '%s': %s\n", r, err)
-						continue
-					}
-					if err := relay.Publish(ctx, *evt); err != nil {
-						logf("failed to publish to '%s': %s\n", r, err)
-						continue
-					}
-					goodRelays = append(goodRelays, relay.URL)
-				}
+			ok, err := confirm("proceed to publish the event? ")
+			if err != nil {
+				return err
 			}
-			if len(goodRelays) == 0 {
+			if !ok {
 				fmt.Println(evt)
 				logf(color.RedString("didn't publish the event\n"))
+				if i == 0 && len(events) > 1 {
+					return fmt.Errorf("the first patch of the series wasn't published, so the others won't be either")
+				}
 				continue
 			}
+			previous = evt
+			goodRelays := publish(ctx, *evt, targetRelays)
+			if len(goodRelays) == 0 {
+				// it's on the outbox, so the rest of the series can go there too
+				logf(color.RedString("didn't publish the event to any relay\n"))
+			}
 
 			code, _ := nip19.EncodeEvent(evt.GetID(), goodRelays, evt.PubKey)
-			fmt.Println(code)
+			if jsonOutput {
+				results = append(results, newPublishedEvent(*evt, code, goodRelays, targetRelays))
+			} else if len(goodRelays) > 0 {
+				fmt.Println(code)
+			}
 		}
 
+		if jsonOutput {
+			printJSON(results)
+		}
 		return nil
 	},
 }
@@ -224,9 +281,39 @@ func getAndApplyTargetRepository(
 		stored = target
 	}
 
+	if target == "" && !interactive() {
+		return nil, fmt.Errorf("no target repository, give it with --to or store it with `git config str.upstream <naddr>`, or use --dangling")
+	}
 	if target == "" {
-		var err error
-		target, err = ask("repository to target with this (naddr1...): ", "", func(answer string) bool {
+		// look for announcements of this same repository before asking
+		prompt := "repository to target with this (naddr1...): "
+		defaultValue := ""
+		candidates := findRepositoriesByCommit(ctx, getEarliestUniqueCommit(), extraRelays)
+		if len(candidates) > 0 {
+			owners := make([]string, len(candidates))
+			for i, repo := range candidates {
+				owners[i] = repo.PubKey
+			}
+			slices.Sort(owners)
+			names := fetchDisplayNames(ctx, extraRelays, slices.Compact(owners))
+
+			logf("%s\n", color.YellowString("found announcements of this repository:"))
+			for i, repo := range candidates {
+				logf("  %d. %s %s %s\n     %s\n", i+1,
+					color.New(color.Bold).Sprint(getRepositoryName(repo)),
+					color.CyanString(names[repo.PubKey]),
+					color.New(color.Faint).Sprint(humanAgo(repo.CreatedAt)),
+					getRepositoryNaddr(repo),
+				)
+			}
+			prompt = fmt.Sprintf("repository to target with this (1-%d or naddr1...): ", len(candidates))
+			defaultValue = "1"
+		}
+
+		answer, err := ask(prompt, defaultValue, func(answer string) bool {
+			if n, err := strconv.Atoi(answer); err == nil {
+				return n < 1 || n > len(candidates)
+			}
 			prefix, _, err := nip19.Decode(answer)
 			if err != nil {
 				return true
@@ -239,6 +326,11 @@ func getAndApplyTargetRepository(
 		if err != nil {
 			return nil, err
 		}
+		if n, err := strconv.Atoi(answer); err == nil {
+			target = getRepositoryNaddr(candidates[n-1])
+		} else {
+			target = answer
+		}
 	}
 
 	_, data, _ := nip19.Decode(target)
@@ -250,42 +342,54 @@ func getAndApplyTargetRepository(
 		return nil, fmt.Errorf("invalid kind %d, expected %d", ep.Kind, RepoAnnouncementKind)
 	}
 
-	filter := nostr.Filter{
-		Tags:    nostr.TagMap{"d": {ep.Identifier}},
-		Authors: []string{ep.PublicKey},
-		Kinds:   []int{ep.Kind},
-	}
-
-	repo := pool.QuerySingle(ctx, append(ep.Relays, extraRelays...), filter)
+	repo := fetchRepository(ctx, ep, extraRelays)
 	if repo == nil {
-		return nil, fmt.Errorf("couldn't find event for %s", filter)
+		return nil, fmt.Errorf("couldn't find repository announcement for %s", target)
 	}
 
 	logf("%s %s\n%s\n", color.YellowString("found upstream repository"),
 		target, sprintRepository(repo.Event))
 
-	if stored != target {
-		if confirm("store it as your main upstream target? ") {
-			git("config", "--local", "str.upstream", target)
-		}
+	if stored != target && confirmOptional("store it as your main upstream target? ") {
+		git("config", "--local", "str.upstream", target)
 	}
 
-	for _, tag := range repo.Event.Tags.GetAll([]string{"patches", ""}) {
-		patchRelays = append(patchRelays, tag[1:]...)
+	patchRelays = getRepositoryRelays(repo.Event)
+
+	// address the other maintainers' announcements too so they all see it
+	maintainers := make([]*nostr.Event, 0, 3)
+	for _, other := range fetchMaintainerRepositories(ctx, ep, extraRelays) {
+		if other.PubKey != ep.PublicKey {
+			maintainers = append(maintainers, other)
+			patchRelays = append(patchRelays, getRepositoryRelays(other)...)
+		}
+	}
+	if len(maintainers) > 0 {
+		logf("%s %d other maintainers\n", color.YellowString("also sending to"), len(maintainers))
 	}
-	for _, tag := range repo.Event.Tags.GetAll([]string{"relays", ""}) {
-		patchRelays = append(patchRelays, tag[1:]...)
+
+	// and to where the owner and maintainers expect to be mentioned
+	recipients := []string{ep.PublicKey}
+	for _, other := range maintainers {
+		recipients = append(recipients, other.PubKey)
 	}
+	patchRelays = append(patchRelays, getInboxRelays(ctx, patchRelays, recipients)...)
 
 	for _, evt := range evts {
 		evt.Tags = append(evt.Tags,
 			nostr.Tag{
 				"a",
 				fmt.Sprintf("%d:%s:%s", ep.Kind, ep.PublicKey, ep.Identifier),
-				repo.Relay.URL,
+				repo.Relay,
 			},
 			nostr.Tag{"p", ep.PublicKey},
 		)
+		for _, other := range maintainers {
+			evt.Tags = append(evt.Tags,
+				nostr.Tag{"a", fmt.Sprintf("%d:%s:%s", RepoAnnouncementKind, other.PubKey, getRepositoryIdentifier(other))},
+				nostr.Tag{"p", other.PubKey},
+			)
+		}
 	}
 
 	return patchRelays, nil
@@ -302,25 +406,42 @@ func getAndApplyTargetThread(
 		ep, ok := data.(nostr.EventPointer)
 		if ok {
 			target = ep.ID
+			mentionRelays = append(mentionRelays, ep.Relays...)
 		}
 	}
 
 	target = strings.TrimSpace(target)
 
-	if target != "" {
-		if nostr.IsValid32ByteHex(target) {
-			return nil, fmt.Errorf("invalid target thread id")
-		}
+	if target == "" {
+		return nil, nil
+	}
+
+	if !nostr.IsValid32ByteHex(target) {
+		return nil, fmt.Errorf("invalid target thread id")
+	}
+	for _, evt := range evts {
+		evt.Tags = append(evt.Tags, nostr.Tag{"e", target})
+		evt.Tags = slices.DeleteFunc(evt.Tags, func(tag nostr.Tag) bool {
+			return len(tag) >= 2 && tag[0] == "t" && tag[1] == "root"
+		})
+	}
+
+	// everybody in the thread should see it
+	relays := concatSlices(mentionRelays, getPatchRelays(), c.StringSlice("relay"))
+	participants := make([]string, 0, 5)
+	if ie := querySingle(ctx, relays, nostr.Filter{IDs: []string{target}}); ie != nil {
+		mentionRelays = append(mentionRelays, ie.Relay)
+		participants = append(participants, ie.PubKey)
 		for _, evt := range evts {
-			evt.Tags = append(evt.Tags, nostr.Tag{"e", target})
-			evt.Tags = slices.DeleteFunc(evt.Tags, func(tag nostr.Tag) bool {
-				return len(tag) >= 2 && tag[0] == "t" && tag[1] == "root"
-			})
+			evt.Tags = append(evt.Tags, nostr.Tag{"p", ie.PubKey})
+		}
+		for _, te := range fetchThread(ctx, relays, getThreadRootID(ie.Event)) {
+			participants = append(participants, te.PubKey)
 		}
 	}
+	mentionRelays = append(mentionRelays, getInboxRelays(ctx, relays, participants)...)
 
-	// TODO: fetch user relays, fetch thread root, return related relays so we can submit the patch to those too
-	return nil, nil
+	return mentionRelays, nil
 }
 
 func getAndApplyTargetMentions(
@@ -328,6 +449,7 @@ func getAndApplyTargetMentions(
 	c *cli.Command,
 	evts []*nostr.Event,
 ) (mentionRelays []string, err error) {
+	mentioned := make([]string, 0, len(c.StringSlice("cc")))
 	for _, target := range c.StringSlice("cc") {
 		prefix, data, err := nip19.Decode(target)
 		if err == nil {
@@ -347,15 +469,87 @@ func getAndApplyTargetMentions(
 			for _, evt := range evts {
 				evt.Tags = append(evt.Tags, nostr.Tag{"p", target})
 			}
+			mentioned = append(mentioned, target)
 		} else {
 			return nil, fmt.Errorf("invalid mention '%s'", target)
 		}
 	}
 
-	// TODO: fetch user relays, fetch thread root, return related relays so we can submit the patch to those too
-	return nil, nil
+	mentionRelays = append(mentionRelays,
+		getInboxRelays(ctx, concatSlices(mentionRelays, c.StringSlice("relay")), mentioned)...)
+	return mentionRelays, nil
+}
+
+// fetchRevisedRoot finds the root of the series a new revision will point to -- if given a revision we
+// go back to the original series, so all revisions point to the same place
+func fetchRevisedRoot(ctx context.Context, target string, extraRelays []string) (*foundEvent, error) {
+	ep, err := parseEventPointer(target)
+	if err != nil {
+		return nil, err
+	}
+	relays := concatSlices(ep.Relays, getPatchRelays(), extraRelays)
+
+	ie := querySingle(ctx, relays, nostr.Filter{IDs: []string{ep.ID}})
+	if ie == nil {
+		return nil, fmt.Errorf("couldn't find patch %s", ep.ID)
+	}
+	if ie.Kind != PatchKind {
+		return nil, fmt.Errorf("event %s is not a patch (kind %d)", ep.ID, ie.Kind)
+	}
+
+	rootID := getRevisedRootID(ie.Event)
+	if rootID == "" {
+		rootID = getThreadRootID(ie.Event)
+	}
+	if rootID != ie.ID {
+		ie = querySingle(ctx, relays, nostr.Filter{IDs: []string{rootID}})
+		if ie == nil {
+			return nil, fmt.Errorf("couldn't find the root of the series, %s", rootID)
+		}
+	}
+
+	return ie, nil
 }
 
 var gitFormatPatchFlags = []cli.Flag{
 	&cli.StringFlag{Name: "base", Hidden: true},
+	&cli.StringFlag{
+		Name:  "reroll-count",
+		Usage: "mark the series as the specified revision, when using --revise it defaults to the previous revision plus one",
+	},
+	&cli.BoolFlag{
+		Name:  "cover-letter",
+		Usage: "generate a cover letter with git-format-patch, it will be opened on the editor and sent as the root of the series",
+	},
+}
+
+// findRepositoriesByCommit returns the announcements that declare the given earliest unique commit, those
+// whose owners are listed as maintainers by the others first, then the most recently updated
+func findRepositoriesByCommit(ctx context.Context, euc string, extraRelays []string) []*nostr.Event {
+	if euc == "" {
+		return nil
+	}
+
+	candidates := latestAnnouncements(queryEvents(ctx, concatSlices(announcementRelays, extraRelays), nostr.Filter{
+		Kinds: []int{RepoAnnouncementKind},
+		Tags:  nostr.TagMap{"r": []string{euc}},
+		Limit: 50,
+	}))
+
+	endorsements := make(map[string]int, len(candidates))
+	for _, repo := range candidates {
+		for _, pk := range getRepositoryMaintainers(repo) {
+			if pk != repo.PubKey {
+				endorsements[pk]++
+			}
+		}
+	}
+	slices.SortStableFunc(candidates, func(a, b *nostr.Event) int {
+		if diff := endorsements[b.PubKey] - endorsements[a.PubKey]; diff != 0 {
+			return diff
+		}
+		return int(b.CreatedAt - a.CreatedAt)
+	})
+
+	return candidates
 }
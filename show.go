@@ -0,0 +1,192 @@
+package gitstr
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip10"
+	"github.com/nbd-wtf/go-nostr/nip19"
+	"github.com/urfave/cli/v3"
+)
+
+var show = &cli.Command{
+	Name:        "show",
+	Usage:       "display a patch or issue with its status and discussion",
+	UsageText:   "git str show <nevent>",
+	Description: "review comments on the patch are shown below the lines they refer to and all other replies are shown as a tree at the end, the output goes through a pager when on a terminal",
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:    "relay",
+			Aliases: []string{"r"},
+			Usage:   "extra relays to search for the patch or issue and its replies in",
+		},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		ep, err := parseEventPointer(c.Args().First())
+		if err != nil {
+			return err
+		}
+
+		relays := concatSlices(ep.Relays, getPatchRelays(), c.StringSlice("relay"))
+		ie := querySingle(ctx, relays, nostr.Filter{IDs: []string{ep.ID}})
+		if ie == nil {
+			return fmt.Errorf("couldn't find event %s", ep.ID)
+		}
+		evt := ie.Event
+		if evt.Kind != PatchKind && evt.Kind != IssueKind {
+			return fmt.Errorf("event %s is not a patch or issue (kind %d)", evt.ID, evt.Kind)
+		}
+
+		var repo *nostr.Event
+		rep, hasRepo := getEventRepositoryPointer(evt)
+		if hasRepo {
+			if ie := fetchRepository(ctx, rep, relays); ie != nil {
+				repo = ie.Event
+				relays = append(relays, getRepositoryRelays(repo)...)
+			}
+		}
+
+		rootID := getThreadRootID(evt)
+		thread := fetchThread(ctx, relays, rootID)
+		root := evt
+		if rootID != evt.ID {
+			if ie := querySingle(ctx, relays, nostr.Filter{IDs: []string{rootID}}); ie != nil {
+				root = ie.Event
+			}
+		}
+		status := fetchStatuses(ctx, relays, []*nostr.Event{root})[rootID]
+
+		pubkeys := []string{evt.PubKey, root.PubKey}
+		for _, te := range thread {
+			pubkeys = append(pubkeys, te.PubKey)
+		}
+		slices.Sort(pubkeys)
+		names := fetchDisplayNames(ctx, relays, slices.Compact(pubkeys))
+
+		if jsonOutput {
+			info := showInfo{Event: evt, Status: statusName(status), Thread: thread}
+			if evt.Kind == PatchKind {
+				info.Subject = getPatchSubject(evt)
+			} else {
+				info.Subject = getIssueSubject(evt)
+			}
+			if hasRepo {
+				info.Repository, _ = nip19.EncodeEntity(rep.PublicKey, rep.Kind, rep.Identifier, rep.Relays)
+			}
+			if root != evt {
+				info.Root = root
+			}
+			printJSON(info)
+			return nil
+		}
+
+		// header
+		bold := color.New(color.Bold)
+		faint := color.New(color.Faint)
+		npub, _ := nip19.EncodePublicKey(evt.PubKey)
+		res := ""
+		if evt.Kind == PatchKind {
+			res += bold.Sprint(getPatchSubject(evt)) + "\n"
+		} else {
+			res += bold.Sprint(getIssueSubject(evt)) + "\n"
+		}
+		res += faint.Sprint("  author: ") + color.CyanString(names[evt.PubKey]) + faint.Sprint(" "+npub) + "\n"
+		res += faint.Sprint("  date: ") + humanDate(evt.CreatedAt) + "\n"
+		if hasRepo {
+			naddr, _ := nip19.EncodeEntity(rep.PublicKey, rep.Kind, rep.Identifier, rep.Relays)
+			name := rep.Identifier
+			if repo != nil {
+				name = getRepositoryName(repo)
+			}
+			res += faint.Sprint("  repository: ") + name + faint.Sprint(" "+naddr) + "\n"
+		}
+		res += faint.Sprint("  status: ") + sprintStatus(status) + "\n"
+		if evt.Kind == PatchKind && evt.ID != rootID {
+			nevent, _ := nip19.EncodeEvent(rootID, nil, "")
+			res += faint.Sprint("  series: ") + nevent + "\n"
+		}
+		res += "\n"
+
+		// body, with the review comments on this patch placed inline
+		inline := make([]*nostr.Event, 0, len(thread))
+		if evt.Kind == PatchKind {
+			for _, te := range thread {
+				if te.Kind == ReplyKind && getCommentLocation(te) != "" && getParentID(te) == evt.ID {
+					inline = append(inline, te)
+				}
+			}
+			res += sprintDiff(evt.Content, names, inline)
+		} else {
+			res += strings.TrimSpace(evt.Content) + "\n"
+		}
+
+		// everything else in the thread
+		children := make(map[string][]*nostr.Event, len(thread))
+		for _, te := range thread {
+			if slices.Contains(inline, te) {
+				continue
+			}
+			parentID := getParentID(te)
+			if te.Kind == PatchKind {
+				// patches in a series reply to each other, but we want them side by side
+				parentID = rootID
+			}
+			children[parentID] = append(children[parentID], te)
+		}
+		if rootID != evt.ID {
+			// we're showing a patch in the middle of a series, so the first one also shows up in the tree
+			children[""] = []*nostr.Event{root}
+			rootID = ""
+		}
+		if discussion := sprintThread(children, rootID, evt.ID, names, ""); discussion != "" {
+			res += "\n" + bold.Sprint("discussion:") + "\n\n" + discussion
+		}
+
+		return page(res)
+	},
+}
+
+// showInfo is what is printed with --json, the thread being all the patches and replies in chronological order
+type showInfo struct {
+	Event      *nostr.Event   `json:"event"`
+	Subject    string         `json:"subject"`
+	Status     string         `json:"status"`
+	Repository string         `json:"repository,omitempty"`
+	Root       *nostr.Event   `json:"root,omitempty"`
+	Thread     []*nostr.Event `json:"thread"`
+}
+
+// getParentID returns the id of the event this one is replying to, according to NIP-10
+func getParentID(evt *nostr.Event) string {
+	if tag := nip10.GetImmediateReply(evt.Tags); tag != nil {
+		return (*tag)[1]
+	}
+	return ""
+}
+
+// sprintThread renders the replies to parentID and their replies recursively, patches are rendered as a
+// single line since their contents can be seen with `git str show`
+func sprintThread(children map[string][]*nostr.Event, parentID string, shownID string, names map[string]string, indent string) string {
+	res := ""
+	for _, evt := range children[parentID] {
+		switch {
+		case evt.ID == shownID:
+			res += indent + color.New(color.Bold).Sprint("● (this patch)") + "\n"
+		case evt.Kind == PatchKind:
+			nevent, _ := nip19.EncodeEvent(evt.ID, nil, "")
+			res += indent + color.New(color.Bold).Sprintf("● %s", getPatchSubject(evt)) +
+				color.New(color.Faint).Sprintf(" %s, %s", names[evt.PubKey], nevent) + "\n"
+		default:
+			if location := getCommentLocation(evt); location != "" {
+				res += indent + color.New(color.Faint).Sprintf("on %s:", location) + "\n"
+			}
+			res += sprintComment(evt, names[evt.PubKey], indent)
+		}
+		res += sprintThread(children, evt.ID, shownID, names, indent+"    ")
+	}
+	return res
+}
@@ -0,0 +1,228 @@
+package gitstr
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+	"github.com/urfave/cli/v3"
+)
+
+var pushState = &cli.Command{
+	Name:        "push-state",
+	Usage:       "publish the current branches and tags of this repository as a signed state event",
+	Description: "",
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:    "relay",
+			Aliases: []string{"r"},
+			Usage:   "extra relays to publish the state to",
+		},
+		&cli.StringFlag{
+			Name:    "sec",
+			Usage:   "secret key to sign the repository state, as hex or nsec, or bunker:// URL, or a NIP-46-powered name@domain",
+			Aliases: []string{"connect"},
+		},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		id := getRepositoryID()
+		if id == "" {
+			return fmt.Errorf("no repository id found on `git config`, call `git str init` first")
+		}
+
+		refs, err := getLocalRefs()
+		if err != nil {
+			return err
+		}
+
+		evt := nostr.Event{
+			CreatedAt: nostr.Now(),
+			Kind:      RepoStateKind,
+			Tags:      append(nostr.Tags{nostr.Tag{"d", id}}, refs...),
+		}
+
+		relays := concatSlices(getPatchRelays(), c.StringSlice("relay"))
+		if len(relays) == 0 {
+			return fmt.Errorf("got no relays to publish to, you can specify one with --relay/-r")
+		}
+
+		sign, err := gatherSigner(ctx, c)
+		if err != nil {
+			return err
+		}
+		if err := sign(&evt); err != nil {
+			return err
+		}
+		if pk := getRepositoryPublicKey(); pk != "" && pk != evt.PubKey {
+			logf(color.YellowString("warning: signing state with a key different from the one that announced the repository\n"))
+		}
+
+		successRelays := publish(ctx, evt, relays)
+		naddr, _ := nip19.EncodeEntity(evt.PubKey, RepoStateKind, id, successRelays)
+		printPublished(evt, naddr, successRelays, relays)
+		if len(successRelays) == 0 {
+			return fmt.Errorf("couldn't publish the event to any relays, use -r or --relay to specify some relays")
+		}
+		return nil
+	},
+}
+
+var state = &cli.Command{
+	Name:        "state",
+	Usage:       "show the signed branches and tags of a repository and check them against its clone URLs",
+	UsageText:   "git str state [naddr]",
+	Description: "",
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:    "relay",
+			Aliases: []string{"r"},
+			Usage:   "extra relays to search for the repository state in",
+		},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		var ep nostr.EntityPointer
+		if arg := c.Args().First(); arg != "" {
+			_, data, _ := nip19.Decode(arg)
+			var ok bool
+			ep, ok = data.(nostr.EntityPointer)
+			if !ok {
+				return fmt.Errorf("invalid argument '%s', expected an naddr", arg)
+			}
+		} else {
+			var err error
+			ep, err = getRepositoryPointer(c)
+			if err != nil {
+				return err
+			}
+		}
+
+		relays := concatSlices(ep.Relays, c.StringSlice("relay"))
+		var cloneURLs []string
+		if repo := fetchRepository(ctx, nostr.EntityPointer{
+			PublicKey:  ep.PublicKey,
+			Kind:       RepoAnnouncementKind,
+			Identifier: ep.Identifier,
+			Relays:     ep.Relays,
+		}, c.StringSlice("relay")); repo != nil {
+			relays = append(relays, getRepositoryRelays(repo.Event)...)
+			for _, tag := range repo.Tags.GetAll([]string{"clone", ""}) {
+				cloneURLs = append(cloneURLs, tag[1:]...)
+			}
+		}
+
+		ie := querySingle(ctx, relays, nostr.Filter{
+			Tags:    nostr.TagMap{"d": {ep.Identifier}},
+			Authors: []string{ep.PublicKey},
+			Kinds:   []int{RepoStateKind},
+		})
+		if ie == nil {
+			return fmt.Errorf("couldn't find a repository state for '%s'", ep.Identifier)
+		}
+
+		logf("%s %s\n", color.YellowString("repository state published"), humanDate(ie.CreatedAt))
+		signed := make(map[string]string)
+		for _, tag := range ie.Tags {
+			if len(tag) < 2 || (tag[0] != "HEAD" && !strings.HasPrefix(tag[0], "refs/")) {
+				continue
+			}
+			signed[tag[0]] = tag[1]
+			if !jsonOutput {
+				fmt.Printf("%s %s\n", tag[1], tag[0])
+			}
+		}
+
+		info := stateInfo{Event: ie.Event, Refs: signed, Clones: make(map[string]cloneState, len(cloneURLs))}
+		for _, url := range cloneURLs {
+			out, err := git("ls-remote", "--heads", "--tags", url)
+			if err != nil {
+				logf(color.RedString("couldn't reach %s: %s\n"), url, err)
+				info.Clones[url] = cloneState{Error: err.Error()}
+				continue
+			}
+
+			remote := make(map[string]string)
+			for _, line := range strings.Split(out, "\n") {
+				commit, ref, ok := strings.Cut(line, "\t")
+				if !ok {
+					continue
+				}
+				if strings.HasSuffix(ref, "^{}") {
+					// peeled annotated tag, that's what we sign
+					ref = strings.TrimSuffix(ref, "^{}")
+				} else if _, ok := remote[ref]; ok {
+					continue
+				}
+				remote[ref] = commit
+			}
+
+			agrees := true
+			for ref, commit := range signed {
+				if ref == "HEAD" {
+					continue
+				}
+				if remote[ref] != commit {
+					agrees = false
+					logf(color.RedString("%s has %s at %s, signed state says %s\n"), url, ref, valueOr(remote[ref], "nothing"), commit)
+				}
+			}
+			for ref := range remote {
+				if _, ok := signed[ref]; !ok {
+					agrees = false
+					logf(color.RedString("%s has %s, which is not in the signed state\n"), url, ref)
+				}
+			}
+			if agrees {
+				logf(color.GreenString("%s agrees with the signed state\n"), url)
+			}
+			info.Clones[url] = cloneState{Agrees: agrees}
+		}
+
+		if jsonOutput {
+			printJSON(info)
+		}
+		return nil
+	},
+}
+
+// stateInfo is what `state` prints with --json
+type stateInfo struct {
+	Event  *nostr.Event          `json:"event"`
+	Refs   map[string]string     `json:"refs"`
+	Clones map[string]cloneState `json:"clones"`
+}
+
+type cloneState struct {
+	Agrees bool   `json:"agrees"`
+	Error  string `json:"error,omitempty"`
+}
+
+// getLocalRefs returns branches, tags and HEAD formatted as repository state tags
+func getLocalRefs() ([]nostr.Tag, error) {
+	out, err := git("for-each-ref", "--format=%(refname) %(objectname) %(*objectname)", "refs/heads", "refs/tags")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read refs: %w", err)
+	}
+
+	refs := make([]nostr.Tag, 0, 10)
+	for _, line := range strings.Split(out, "\n") {
+		spl := strings.Fields(line)
+		if len(spl) < 2 {
+			continue
+		}
+		commit := spl[1]
+		if len(spl) == 3 {
+			// annotated tag, use the commit it points to
+			commit = spl[2]
+		}
+		refs = append(refs, nostr.Tag{spl[0], commit})
+	}
+
+	if head, err := git("symbolic-ref", "HEAD"); err == nil {
+		refs = append(refs, nostr.Tag{"HEAD", "ref: " + head})
+	}
+
+	return refs, nil
+}
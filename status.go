@@ -0,0 +1,213 @@
+package gitstr
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+	"github.com/urfave/cli/v3"
+)
+
+var statusKinds = map[string]int{
+	"open":    StatusOpenKind,
+	"applied": StatusAppliedKind,
+	"closed":  StatusClosedKind,
+	"draft":   StatusDraftKind,
+}
+
+var status = &cli.Command{
+	Name:        "status",
+	Usage:       "mark a patch or issue as open, applied, closed or draft",
+	UsageText:   "git str status <nevent> applied|closed|draft|open",
+	Description: "",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "sec",
+			Usage:   "secret key to sign the status, as hex or nsec, or bunker:// URL, or a NIP-46-powered name@domain",
+			Aliases: []string{"connect"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "commit",
+			Aliases: []string{"c"},
+			Usage:   "when marking as applied, the commits the patches were applied as",
+		},
+		&cli.StringFlag{
+			Name:  "merge-commit",
+			Usage: "when marking as applied, the commit that merged the patches",
+		},
+		&cli.StringFlag{
+			Name:    "message",
+			Aliases: []string{"m"},
+			Usage:   "optional comment to attach to the status",
+		},
+		&cli.StringSliceFlag{
+			Name:    "relay",
+			Aliases: []string{"r"},
+			Usage:   "extra relays to search for the patch or issue in and to publish the status to",
+		},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		ep, err := parseEventPointer(c.Args().Get(0))
+		if err != nil {
+			return err
+		}
+		kind, ok := statusKinds[c.Args().Get(1)]
+		if !ok {
+			return fmt.Errorf("invalid status '%s', expected one of applied, closed, draft or open", c.Args().Get(1))
+		}
+
+		relays := concatSlices(ep.Relays, getPatchRelays(), c.StringSlice("relay"))
+		ie := querySingle(ctx, relays, nostr.Filter{IDs: []string{ep.ID}})
+		if ie == nil {
+			return fmt.Errorf("couldn't find event %s", ep.ID)
+		}
+		root := ie.Event
+		if root.Kind != PatchKind && root.Kind != IssueKind {
+			return fmt.Errorf("event %s is not a patch or issue (kind %d)", root.ID, root.Kind)
+		}
+		if rootID := getThreadRootID(root); rootID != root.ID {
+			ie = querySingle(ctx, relays, nostr.Filter{IDs: []string{rootID}})
+			if ie == nil {
+				return fmt.Errorf("couldn't find thread root %s", rootID)
+			}
+			root = ie.Event
+		}
+
+		evt := &nostr.Event{
+			CreatedAt: nostr.Now(),
+			Kind:      kind,
+			Content:   c.String("message"),
+			Tags: nostr.Tags{
+				nostr.Tag{"alt", "git status: " + c.Args().Get(1)},
+				nostr.Tag{"p", root.PubKey},
+			},
+		}
+		if original := getRevisedRootID(root); original != "" {
+			// statuses of revisions point to the original series, with the revision as the reply
+			evt.Tags = append(evt.Tags,
+				nostr.Tag{"e", original, "", "root"},
+				nostr.Tag{"e", root.ID, ie.Relay, "reply"},
+			)
+		} else {
+			evt.Tags = append(evt.Tags, nostr.Tag{"e", root.ID, ie.Relay, "root"})
+		}
+		if rep, ok := getEventRepositoryPointer(root); ok {
+			// the same tag the pointer came from, patches may reference other things too
+			aTag := root.Tags.GetFirst([]string{"a", fmt.Sprintf("%d:", RepoAnnouncementKind)})
+			evt.Tags = append(evt.Tags, *aTag, nostr.Tag{"p", rep.PublicKey})
+			if repo := fetchRepository(ctx, rep, relays); repo != nil {
+				relays = append(relays, getRepositoryRelays(repo.Event)...)
+			}
+		}
+
+		if kind == StatusAppliedKind {
+			if mc := c.String("merge-commit"); mc != "" {
+				commit, err := git("rev-parse", mc)
+				if err != nil {
+					return fmt.Errorf("invalid merge commit '%s': %w", mc, err)
+				}
+				evt.Tags = append(evt.Tags, nostr.Tag{"merge-commit", commit}, nostr.Tag{"r", commit})
+			}
+			if refs := c.StringSlice("commit"); len(refs) > 0 {
+				applied := nostr.Tag{"applied-as-commits"}
+				for _, ref := range refs {
+					commit, err := git("rev-parse", ref)
+					if err != nil {
+						return fmt.Errorf("invalid commit '%s': %w", ref, err)
+					}
+					applied = append(applied, commit)
+					evt.Tags = append(evt.Tags, nostr.Tag{"r", commit})
+				}
+				evt.Tags = append(evt.Tags, applied)
+			}
+		}
+
+		sign, err := gatherSigner(ctx, c)
+		if err != nil {
+			return err
+		}
+		if err := sign(evt); err != nil {
+			return err
+		}
+
+		goodRelays := publish(ctx, *evt, relays)
+		code, _ := nip19.EncodeEvent(evt.ID, goodRelays, evt.PubKey)
+		printPublished(*evt, code, goodRelays, relays)
+		if len(goodRelays) == 0 {
+			return fmt.Errorf("didn't publish the event")
+		}
+		return nil
+	},
+}
+
+// fetchStatuses returns the latest valid status event for the threads the given patches or issues belong to,
+// keyed by thread root id. statuses are only considered valid when issued by the authors of the patches or by
+// the owner of the target repository
+func fetchStatuses(ctx context.Context, relays []string, events []*nostr.Event) map[string]*nostr.Event {
+	statuses := make(map[string]*nostr.Event, len(events))
+	if len(events) == 0 {
+		return statuses
+	}
+
+	allowed := make(map[string][]string, len(events))
+	ids := make([]string, 0, len(events))
+	for _, evt := range events {
+		rootID := getThreadRootID(evt)
+		if _, ok := allowed[rootID]; !ok {
+			ids = append(ids, rootID)
+		}
+		allowed[rootID] = append(allowed[rootID], evt.PubKey)
+		// the repository owner and co-maintainers
+		for _, tag := range evt.Tags.GetAll([]string{"a", fmt.Sprintf("%d:", RepoAnnouncementKind)}) {
+			if spl := strings.SplitN(tag[1], ":", 3); len(spl) == 3 {
+				allowed[rootID] = append(allowed[rootID], spl[1])
+			}
+		}
+	}
+
+	for _, evt := range queryEvents(ctx, relays, nostr.Filter{
+		Kinds: []int{StatusOpenKind, StatusAppliedKind, StatusClosedKind, StatusDraftKind},
+		Tags:  nostr.TagMap{"e": ids},
+	}) {
+		for _, tag := range evt.Tags.GetAll([]string{"e", ""}) {
+			authors, ok := allowed[tag[1]]
+			if !ok || !slices.Contains(authors, evt.PubKey) {
+				continue
+			}
+			if curr, ok := statuses[tag[1]]; !ok || curr.CreatedAt < evt.CreatedAt {
+				statuses[tag[1]] = evt
+			}
+		}
+	}
+
+	return statuses
+}
+
+func statusName(status *nostr.Event) string {
+	if status == nil {
+		return "open"
+	}
+	for name, kind := range statusKinds {
+		if kind == status.Kind {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+func sprintStatus(status *nostr.Event) string {
+	switch name := statusName(status); name {
+	case "open":
+		return color.GreenString(name)
+	case "applied":
+		return color.MagentaString(name)
+	case "closed":
+		return color.RedString(name)
+	default:
+		return color.New(color.Faint).Sprint(name)
+	}
+}
@@ -0,0 +1,199 @@
+package gitstr
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// eventStore is an append-only JSONL file of every event we've seen, kept at .git/str/events.jsonl,
+// plus where each relay was left at by `git str sync` for each repository, kept at .git/str/sync.json
+type eventStore struct {
+	sync.Mutex
+	dir     string
+	events  map[string]storedEvent
+	cursors map[string]syncCursor
+}
+
+// syncCursor is the timestamp of the latest event a relay gave us for a repository, along with the patches
+// and issues we had then -- replies and statuses to those don't have to be asked for since the beginning
+type syncCursor struct {
+	Since nostr.Timestamp `json:"since"`
+	Roots []string        `json:"roots"`
+}
+
+type storedEvent struct {
+	Event *nostr.Event `json:"event"`
+	Relay string       `json:"relay,omitempty"`
+}
+
+// storedKinds are the kinds `git str sync` fetches, other events we see (profiles, relay lists,
+// announcements from searches) aren't worth keeping
+var storedKinds = []int{PatchKind, IssueKind, ReplyKind, StatusOpenKind, StatusAppliedKind, StatusClosedKind, StatusDraftKind}
+
+var (
+	store     *eventStore
+	storeOnce sync.Once
+)
+
+// getStore opens the local event store, returning nil when we're not inside a git repository
+func getStore() *eventStore {
+	storeOnce.Do(func() {
+		gitDir, err := git("rev-parse", "--absolute-git-dir")
+		if err != nil {
+			return
+		}
+		dir := filepath.Join(gitDir, "str")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return
+		}
+
+		s := &eventStore{
+			dir:     dir,
+			events:  make(map[string]storedEvent),
+			cursors: make(map[string]syncCursor),
+		}
+
+		if f, err := os.Open(filepath.Join(dir, "events.jsonl")); err == nil {
+			scanner := bufio.NewScanner(f)
+			scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+			for scanner.Scan() {
+				var se storedEvent
+				if err := json.Unmarshal(scanner.Bytes(), &se); err != nil || se.Event == nil {
+					continue
+				}
+				s.events[se.Event.ID] = se
+			}
+			f.Close()
+		}
+
+		if b, err := os.ReadFile(filepath.Join(dir, "sync.json")); err == nil {
+			json.Unmarshal(b, &s.cursors)
+		}
+
+		store = s
+	})
+	return store
+}
+
+func (s *eventStore) save(relay string, events ...*nostr.Event) {
+	if s == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+
+	f, err := os.OpenFile(filepath.Join(s.dir, "events.jsonl"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	for _, evt := range events {
+		if _, ok := s.events[evt.ID]; ok || !slices.Contains(storedKinds, evt.Kind) {
+			continue
+		}
+		se := storedEvent{Event: evt, Relay: relay}
+		b, err := json.Marshal(se)
+		if err != nil {
+			continue
+		}
+		if _, err := f.Write(append(b, '\n')); err != nil {
+			return
+		}
+		s.events[evt.ID] = se
+	}
+}
+
+func (s *eventStore) query(filter nostr.Filter) []storedEvent {
+	if s == nil {
+		return nil
+	}
+	s.Lock()
+	defer s.Unlock()
+
+	result := make([]storedEvent, 0, 10)
+	for _, se := range s.events {
+		if filter.Matches(se.Event) {
+			result = append(result, se)
+		}
+	}
+	slices.SortFunc(result, func(a, b storedEvent) int { return int(b.Event.CreatedAt - a.Event.CreatedAt) })
+	if filter.Limit > 0 && len(result) > filter.Limit {
+		result = result[0:filter.Limit]
+	}
+	return result
+}
+
+func (s *eventStore) getSyncCursor(relay string, address string) syncCursor {
+	s.Lock()
+	defer s.Unlock()
+	return s.cursors[nostr.NormalizeURL(relay)+" "+address]
+}
+
+func (s *eventStore) setSyncCursor(relay string, address string, cursor syncCursor) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.cursors[nostr.NormalizeURL(relay)+" "+address] = cursor
+	if b, err := json.Marshal(s.cursors); err == nil {
+		os.WriteFile(filepath.Join(s.dir, "sync.json"), b, 0644)
+	}
+}
+
+// foundEvent is an event along with the URL of the relay we got it from, which is empty when it came from
+// the local store without one
+type foundEvent struct {
+	*nostr.Event
+	Relay string
+}
+
+// querySingle is like pool.QuerySingle, but looks into the local store first when asking for specific ids
+// and falls back to it when no relay has what we want -- whatever comes from relays gets stored
+func querySingle(ctx context.Context, relays []string, filter nostr.Filter) *foundEvent {
+	local := getStore().query(filter)
+	if len(filter.IDs) > 0 && len(local) > 0 {
+		return &foundEvent{Event: local[0].Event, Relay: local[0].Relay}
+	}
+
+	if ie := pool.QuerySingle(ctx, relays, filter); ie != nil {
+		getStore().save(ie.Relay.URL, ie.Event)
+		return &foundEvent{Event: ie.Event, Relay: ie.Relay.URL}
+	}
+
+	if len(local) > 0 {
+		return &foundEvent{Event: local[0].Event, Relay: local[0].Relay}
+	}
+	return nil
+}
+
+// queryEvents returns the events matching filter from both the local store and the relays, newest first
+func queryEvents(ctx context.Context, relays []string, filter nostr.Filter) []*nostr.Event {
+	seen := make(map[string]bool)
+	events := make([]*nostr.Event, 0, 10)
+	for _, se := range getStore().query(filter) {
+		seen[se.Event.ID] = true
+		events = append(events, se.Event)
+	}
+
+	for ie := range pool.SubManyEose(ctx, relays, nostr.Filters{filter}) {
+		getStore().save(ie.Relay.URL, ie.Event)
+		if seen[ie.ID] {
+			continue
+		}
+		seen[ie.ID] = true
+		events = append(events, ie.Event)
+	}
+
+	slices.SortFunc(events, func(a, b *nostr.Event) int { return int(b.CreatedAt - a.CreatedAt) })
+	if filter.Limit > 0 && len(events) > filter.Limit {
+		events = events[0:filter.Limit]
+	}
+	return events
+}
@@ -0,0 +1,117 @@
+package gitstr
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/fatih/color"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/urfave/cli/v3"
+)
+
+var syncCmd = &cli.Command{
+	Name:        "sync",
+	Usage:       "fetch new patches, issues, replies and statuses into the local store",
+	Description: "events are stored in .git/str/events.jsonl and all other commands read from there first, so they keep working offline",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "to",
+			Aliases: []string{"a", "repository"},
+			Usage:   "repository reference, as an naddr1... code",
+		},
+		&cli.StringSliceFlag{
+			Name:    "relay",
+			Aliases: []string{"r"},
+			Usage:   "extra relays to sync from",
+		},
+	},
+	Action: func(ctx context.Context, c *cli.Command) error {
+		s := getStore()
+		if s == nil {
+			return fmt.Errorf("not inside a git repository")
+		}
+
+		ep, err := getRepositoryPointer(c)
+		if err != nil {
+			return err
+		}
+
+		relays := concatSlices(ep.Relays, c.StringSlice("relay"))
+		if repo := fetchRepository(ctx, ep, c.StringSlice("relay")); repo != nil {
+			relays = append(relays, getRepositoryRelays(repo.Event)...)
+		}
+		slices.Sort(relays)
+		relays = slices.Compact(relays)
+
+		// replies and statuses don't always reference the repository, so we also ask for those
+		// that reference the patches and issues we already have
+		rootIDs := make([]string, 0, 50)
+		for _, se := range s.query(nostr.Filter{Kinds: []int{PatchKind, IssueKind}}) {
+			if getThreadRootID(se.Event) == se.Event.ID {
+				rootIDs = append(rootIDs, se.Event.ID)
+			}
+		}
+
+		address := fmt.Sprintf("%d:%s:%s", ep.Kind, ep.PublicKey, ep.Identifier)
+		counts := make(map[string]int, len(relays))
+		for _, url := range relays {
+			cursor := s.getSyncCursor(url, address)
+			var since *nostr.Timestamp
+			if cursor.Since > 0 {
+				since = &cursor.Since
+			}
+
+			filters := nostr.Filters{
+				{
+					Kinds: []int{PatchKind, IssueKind, ReplyKind, StatusOpenKind, StatusAppliedKind, StatusClosedKind, StatusDraftKind},
+					Tags:  nostr.TagMap{"a": []string{address}},
+					Since: since,
+				},
+			}
+
+			// roots we didn't have on the last sync from this relay may have older replies
+			oldRoots := make([]string, 0, len(rootIDs))
+			newRoots := make([]string, 0, len(rootIDs))
+			for _, id := range rootIDs {
+				if since != nil && slices.Contains(cursor.Roots, id) {
+					oldRoots = append(oldRoots, id)
+				} else {
+					newRoots = append(newRoots, id)
+				}
+			}
+			if len(oldRoots) > 0 {
+				filters = append(filters, nostr.Filter{
+					Kinds: []int{PatchKind, ReplyKind, StatusOpenKind, StatusAppliedKind, StatusClosedKind, StatusDraftKind},
+					Tags:  nostr.TagMap{"e": oldRoots},
+					Since: since,
+				})
+			}
+			if len(newRoots) > 0 {
+				filters = append(filters, nostr.Filter{
+					Kinds: []int{PatchKind, ReplyKind, StatusOpenKind, StatusAppliedKind, StatusClosedKind, StatusDraftKind},
+					Tags:  nostr.TagMap{"e": newRoots},
+				})
+			}
+
+			logf("syncing from %s...", url)
+			count := 0
+			latest := cursor.Since
+			for ie := range pool.SubManyEose(ctx, []string{url}, filters) {
+				s.save(ie.Relay.URL, ie.Event)
+				count++
+				if ie.CreatedAt > latest {
+					latest = ie.CreatedAt
+				}
+			}
+			s.setSyncCursor(url, address, syncCursor{Since: latest, Roots: rootIDs})
+			logf(" %s\n", color.GreenString("%d events", count))
+			counts[url] = count
+		}
+
+		if jsonOutput {
+			printJSON(counts)
+		}
+		return nil
+	},
+}